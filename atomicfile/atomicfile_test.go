@@ -0,0 +1,41 @@
+package atomicfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atomicfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "file")
+
+	for _, s := range []string{"first", "second"} {
+		if err := WriteFile(name, []byte(s), 0600); err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadFile(name)
+		if err != nil || string(b) != s {
+			t.Errorf("read %q, %v, want %q", b, err, s)
+		}
+	}
+	fi, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("mode %v, want 0600", fi.Mode())
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("temporary files left behind: %d files", len(files))
+	}
+
+	if err := WriteFile(filepath.Join(dir, "missing", "file"), nil, 0600); err == nil {
+		t.Error("writing into a missing directory succeeded")
+	}
+}
@@ -0,0 +1,166 @@
+package catalog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/notary/tuf/data"
+	"github.com/docker/notary/tuf/store"
+)
+
+// CachedRole describes a role's metadata in the local trust data cache.
+type CachedRole struct {
+	Role    string
+	Version int
+	Expires time.Time
+}
+
+// Expired reports whether the metadata had expired at t.
+func (r CachedRole) Expired(t time.Time) bool {
+	return !t.Before(r.Expires)
+}
+
+// NearExpiry reports whether the metadata expires within window of t. Root
+// metadata is near expiry within six months, as for the notary client, which
+// re-signs it on the next publish.
+func (r CachedRole) NearExpiry(t time.Time, window time.Duration) bool {
+	if r.Role == data.CanonicalRootRole {
+		return r.Expires.Before(t.AddDate(0, 6, 0))
+	}
+	return r.Expires.Before(t.Add(window))
+}
+
+// ErrCacheExpired is returned offline when the cached trust data has no
+// unexpired metadata for the catalog.
+type ErrCacheExpired struct {
+	GUN     string
+	Expired []CachedRole
+}
+
+func (err ErrCacheExpired) Error() string {
+	roles := make([]string, len(err.Expired))
+	for i, r := range err.Expired {
+		roles[i] = fmt.Sprintf("%s expired %s", r.Role, r.Expires.Local().Format("2006-01-02 15:04"))
+	}
+	return fmt.Sprintf("cached trust data for %s has expired (%s) and must be refreshed from the notary server", err.GUN, strings.Join(roles, ", "))
+}
+
+// ErrNotCached is returned offline when there is no cached trust data for
+// the catalog.
+type ErrNotCached struct {
+	GUN string
+}
+
+func (err ErrNotCached) Error() string {
+	return fmt.Sprintf("no trust data for %s is cached, go online once to fetch it", err.GUN)
+}
+
+// metadataDir returns the directory the notary client caches the
+// catalog's TUF metadata in.
+func (c *Catalog) metadataDir() string {
+	return filepath.Join(c.TrustDir, "tuf", filepath.FromSlash(c.GUN), "metadata")
+}
+
+// CachedRoles returns the catalog's cached metadata, base roles first and
+// delegations after them by name. The metadata is not verified.
+func (c *Catalog) CachedRoles() ([]CachedRole, error) {
+	dir := c.metadataDir()
+	var roles []CachedRole
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() || filepath.Ext(path) != ".json" {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var meta struct {
+			Signed struct {
+				Version int       `json:"version"`
+				Expires time.Time `json:"expires"`
+			} `json:"signed"`
+		}
+		if err := json.Unmarshal(b, &meta); err != nil {
+			return fmt.Errorf("cached metadata %s is corrupt: %v", path, err)
+		}
+		roles = append(roles, CachedRole{
+			Role:    filepath.ToSlash(strings.TrimSuffix(rel, ".json")),
+			Version: meta.Signed.Version,
+			Expires: meta.Signed.Expires,
+		})
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	sort.Sort(byRolePriority(roles))
+	return roles, err
+}
+
+// explainOffline replaces the error the notary client returns when it
+// needed the network while offline with the reason it did: the cache is
+// missing or has expired.
+func (c *Catalog) explainOffline(err error) error {
+	if _, ok := err.(store.ErrOffline); !ok || !c.Offline {
+		return err
+	}
+	if err := c.CheckCache(time.Now()); err != nil {
+		return err
+	}
+	return fmt.Errorf("cached trust data for %s is incomplete, go online to refresh it", c.GUN)
+}
+
+// CheckCache returns ErrNotCached if there is no cached trust data for the
+// catalog, and ErrCacheExpired if any of it had expired at t.
+func (c *Catalog) CheckCache(t time.Time) error {
+	roles, err := c.CachedRoles()
+	if err != nil {
+		return err
+	}
+	if len(roles) == 0 {
+		return ErrNotCached{GUN: c.GUN}
+	}
+	var expired []CachedRole
+	for _, r := range roles {
+		if r.Expired(t) {
+			expired = append(expired, r)
+		}
+	}
+	if len(expired) > 0 {
+		return ErrCacheExpired{GUN: c.GUN, Expired: expired}
+	}
+	return nil
+}
+
+// basePriority orders the base roles in CachedRoles.
+var basePriority = map[string]int{
+	data.CanonicalRootRole:      1,
+	data.CanonicalTargetsRole:   2,
+	data.CanonicalSnapshotRole:  3,
+	data.CanonicalTimestampRole: 4,
+}
+
+type byRolePriority []CachedRole
+
+func (r byRolePriority) Len() int      { return len(r) }
+func (r byRolePriority) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r byRolePriority) Less(i, j int) bool {
+	pi, pj := basePriority[r[i].Role], basePriority[r[j].Role]
+	switch {
+	case pi == 0 && pj == 0:
+		return r[i].Role < r[j].Role
+	case pi == 0 || pj == 0:
+		return pj == 0
+	}
+	return pi < pj
+}
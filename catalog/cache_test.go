@@ -0,0 +1,112 @@
+package catalog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/notary/tuf/data"
+)
+
+// offlineCatalog opens the catalog cached in dir without a network.
+func offlineCatalog(t *testing.T, dir string) *Catalog {
+	c, err := Open(dir, "https://notary.invalid", testGUN, nil, testRetriever)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCheckCacheCold(t *testing.T) {
+	dir, err := ioutil.TempDir("", "catalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := offlineCatalog(t, dir)
+	if roles, err := c.CachedRoles(); err != nil || len(roles) != 0 {
+		t.Errorf("cold cache holds %v, %v", roles, err)
+	}
+	if err := c.CheckCache(time.Now()); err != (ErrNotCached{GUN: testGUN}) {
+		t.Errorf("checking a cold cache: %v", err)
+	}
+	if _, err := c.Lookup("atom"); err != (ErrNotCached{GUN: testGUN}) {
+		t.Errorf("looking up offline with a cold cache: %v", err)
+	}
+}
+
+func TestCheckCacheWarm(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	s.addTarget(data.CanonicalTargetsRole, "atom")
+	s.addDelegation("targets/sky", data.KeyList{s.createKey("targets/sky")}, 1, "sky")
+	s.addTarget("targets/sky", "sky")
+	s.publish()
+
+	online := testCatalog(t, s)
+	defer os.RemoveAll(online.TrustDir)
+	if _, err := online.List(); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	c := offlineCatalog(t, online.TrustDir)
+	roles, err := c.CachedRoles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, r := range roles {
+		names = append(names, r.Role)
+	}
+	want := []string{
+		data.CanonicalRootRole,
+		data.CanonicalTargetsRole,
+		data.CanonicalSnapshotRole,
+		data.CanonicalTimestampRole,
+		"targets/sky",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("cached %v, want %v", names, want)
+	}
+
+	now := time.Now()
+	if err := c.CheckCache(now); err != nil {
+		t.Errorf("checking a warm cache: %v", err)
+	}
+	if app, err := c.Lookup("atom"); err != nil || app.Name != "atom" {
+		t.Errorf("looking up offline with a warm cache: %v", err)
+	}
+
+	// the timestamp expires first, after two weeks
+	later := now.Add(data.DefaultExpires(data.CanonicalTimestampRole).Sub(now) + time.Hour)
+	err = c.CheckCache(later)
+	expired, ok := err.(ErrCacheExpired)
+	if !ok {
+		t.Fatalf("checking an expired cache: %v", err)
+	}
+	if expired.GUN != testGUN || len(expired.Expired) != 1 || expired.Expired[0].Role != data.CanonicalTimestampRole {
+		t.Errorf("expired %+v, want only the timestamp", expired)
+	}
+}
+
+func TestCheckCacheCorrupt(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+
+	c := testCatalog(t, s)
+	defer os.RemoveAll(c.TrustDir)
+	if _, err := c.List(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(c.metadataDir(), "timestamp.json"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := offlineCatalog(t, c.TrustDir).CheckCache(time.Now()); err == nil {
+		t.Error("checking a corrupt cache succeeded")
+	}
+}
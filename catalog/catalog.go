@@ -0,0 +1,218 @@
+// Package catalog provides access to the signed conman application catalog
+// stored in a notary trusted collection.
+package catalog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/notary/passphrase"
+	"github.com/endophage/conman/manifest"
+	"github.com/endophage/conman/registry"
+	"github.com/riyazdf/notary/client"
+)
+
+const (
+	// DefaultGUN is the trusted collection conman apps are published to.
+	DefaultGUN = "docker.io/conman/apps"
+	// DefaultServer is the notary server hosting DefaultGUN.
+	DefaultServer = "https://notary.docker.io"
+	// DefaultRepository is the image repository of apps whose manifest does
+	// not name an image.
+	DefaultRepository = "conman/apps"
+)
+
+// ErrAppNotFound is returned when the catalog has no verified target for
+// an application.
+type ErrAppNotFound struct {
+	Name string
+}
+
+func (err ErrAppNotFound) Error() string {
+	return fmt.Sprintf("no verified target for %s in the catalog", err.Name)
+}
+
+// App is a catalog target together with its decoded manifest.
+type App struct {
+	client.Target
+	// Role is the TUF role that signed the target.
+	Role     string
+	Manifest *manifest.Manifest
+	// Invalid is set, and Manifest is nil, for apps listed with a manifest
+	// that failed to decode.
+	Invalid error
+}
+
+// Catalog is a notary trusted collection of conman applications.
+type Catalog struct {
+	GUN  string
+	Repo *client.NotaryRepository
+	// TrustDir is the directory trust data is cached under.
+	TrustDir string
+	// Offline is set if the catalog only uses cached trust data.
+	Offline bool
+	// Channel is the release channel apps are looked up on, Stable if
+	// empty.
+	Channel string
+	// Pin, if set, is the root of trust the catalog must be signed with.
+	Pin *Pin
+	// Versions, if set, records the highest metadata versions verified, and
+	// older metadata is refused.
+	Versions *VersionLog
+	// Staleness is how long the timestamp may go without advancing before
+	// the catalog is considered frozen, never if zero.
+	Staleness time.Duration
+
+	// server and rt reach the notary server for pushes the notary client
+	// cannot make.
+	server string
+	rt     http.RoundTripper
+}
+
+// Open returns the catalog for gun on the given notary server, caching trust
+// data under trustDir. With a nil rt the catalog is offline, and only uses
+// the cached trust data as long as it has not expired.
+func Open(trustDir, server, gun string, rt http.RoundTripper, retriever passphrase.Retriever) (*Catalog, error) {
+	repo, err := client.NewNotaryRepository(trustDir, gun, server, rt, retriever)
+	if err != nil {
+		return nil, err
+	}
+	return &Catalog{GUN: gun, Repo: repo, TrustDir: trustDir, Offline: rt == nil, server: server, rt: rt}, nil
+}
+
+// Lookup fetches and verifies the target for the named application on the
+// catalog's channel and decodes its manifest.
+func (c *Catalog) Lookup(name string) (*App, error) {
+	roles, err := searchRoles(c.Channel)
+	if err != nil {
+		return nil, err
+	}
+	tgt, err := c.Repo.GetTargetByName(name, roles...)
+	if err != nil {
+		if isNoTrustData(err) {
+			return nil, ErrAppNotFound{Name: name}
+		}
+		return nil, c.explainOffline(err)
+	}
+	if err := c.checkUpdate(); err != nil {
+		return nil, err
+	}
+	if !onChannel(c.Channel, tgt.Role) {
+		return nil, ErrAppNotFound{Name: name}
+	}
+	if err := c.checkSigner(tgt.Name, tgt.Role); err != nil {
+		return nil, err
+	}
+	return newApp(tgt)
+}
+
+// List returns every application on the catalog's channel, sorted by name. Apps with
+// invalid manifests, or signed by a publisher that may not sign them, are
+// included with Invalid set.
+func (c *Catalog) List() ([]*App, error) {
+	roles, err := searchRoles(c.Channel)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := c.Repo.ListTargets(roles...)
+	if err != nil {
+		return nil, c.explainOffline(err)
+	}
+	if err := c.checkUpdate(); err != nil {
+		return nil, err
+	}
+	apps := make([]*App, 0, len(targets))
+	for _, tgt := range targets {
+		if !onChannel(c.Channel, tgt.Role) {
+			continue
+		}
+		app, err := newApp(tgt)
+		if err == nil {
+			err = c.checkSigner(tgt.Name, tgt.Role)
+		}
+		if err != nil {
+			app = &App{Target: tgt.Target, Role: tgt.Role, Invalid: err}
+		}
+		apps = append(apps, app)
+	}
+	sort.Sort(byName(apps))
+	return apps, nil
+}
+
+// Matches reports whether the app's name or desktop Name contains query,
+// ignoring case, and whether it handles mimeType. Empty arguments match
+// every app.
+func (a *App) Matches(query, mimeType string) bool {
+	if query != "" {
+		query = strings.ToLower(query)
+		title := ""
+		if a.Manifest != nil {
+			title = a.Manifest.DesktopValue("Name")
+		}
+		if !strings.Contains(strings.ToLower(a.Name), query) && !strings.Contains(strings.ToLower(title), query) {
+			return false
+		}
+	}
+	if mimeType != "" {
+		if a.Manifest == nil {
+			return false
+		}
+		for _, mt := range a.Manifest.MimeTypes {
+			if mt == mimeType {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+type byName []*App
+
+func (a byName) Len() int           { return len(a) }
+func (a byName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byName) Less(i, j int) bool { return a[i].Name < a[j].Name }
+
+// ImageFor returns the image reference, by tag, of the named application.
+func ImageFor(name string, m *manifest.Manifest) string {
+	if m.Run != nil && m.Run.Image != "" {
+		return m.Run.Image
+	}
+	return DefaultRepository + ":" + name
+}
+
+// PinnedImage returns a reference to the application's image by the sha256
+// digest recorded in its verified target, rather than by mutable tag.
+func (a *App) PinnedImage() (string, error) {
+	digest := a.Hashes["sha256"]
+	if len(digest) != sha256.Size {
+		return "", fmt.Errorf("%s: target has no sha256 digest to pin the image to", a.Name)
+	}
+	ref, err := registry.ParseReference(ImageFor(a.Name, a.Manifest))
+	if err != nil {
+		return "", err
+	}
+	return ref.WithDigest(hex.EncodeToString(digest)), nil
+}
+
+func newApp(tgt *client.TargetWithRole) (*App, error) {
+	if err := manifest.CheckAppName(tgt.Name); err != nil {
+		return nil, err
+	}
+	m, err := manifest.FromCustom(tgt.Custom)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", tgt.Name, err)
+	}
+	return &App{Target: tgt.Target, Role: tgt.Role, Manifest: m}, nil
+}
+
+// isNoTrustData reports whether err is the untyped error the notary client
+// returns when a target cannot be found in any of the searched roles.
+func isNoTrustData(err error) bool {
+	return strings.HasPrefix(err.Error(), "No trust data for ")
+}
@@ -0,0 +1,324 @@
+package catalog
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/notary/cryptoservice"
+	"github.com/docker/notary/passphrase"
+	"github.com/docker/notary/trustmanager"
+	"github.com/docker/notary/tuf"
+	"github.com/docker/notary/tuf/data"
+	"github.com/docker/notary/tuf/signed"
+	"github.com/endophage/conman/manifest"
+)
+
+const testGUN = "docker.io/conman/apps"
+
+const testManifest = `{
+	"desktop":"[Desktop Entry]\nType=Application\nName=Atom\nIcon=atom\nTerminal=false",
+	"icon":{"url":"https://example.com/atom.png","checksum":{"sha256":"YhQp8qbH2G7HhAHUtPMjxCrj0l7yFcUZ7VvQwSEtdEQ="}},
+	"mimetypes":[],
+	"run":{"image":"conman/apps:atom","x11":true}
+}`
+
+var testRetriever = passphrase.ConstantRetriever("passphrase")
+
+// testServer is a notary server serving the metadata of a TUF repository it
+// holds every key of.
+type testServer struct {
+	*httptest.Server
+	t    *testing.T
+	keys *cryptoservice.CryptoService
+	repo *tuf.Repo
+	// RootKeyID is the root key's ID as listed in root.json, and
+	// RootCanonicalID its canonical ID.
+	RootKeyID, RootCanonicalID string
+	// RootCert is the certificate of the root key.
+	RootCert *x509.Certificate
+	// pushed holds the targets metadata of delegations uploaded by their
+	// signers, by role.
+	pushed map[string]*data.Signed
+
+	mu sync.Mutex
+	// meta holds the served metadata by role.
+	meta map[string][]byte
+}
+
+func newTestServer(t *testing.T) *testServer {
+	s := &testServer{
+		t:      t,
+		keys:   cryptoservice.NewCryptoService(testGUN, trustmanager.NewKeyMemoryStore(testRetriever)),
+		pushed: make(map[string]*data.Signed),
+	}
+	rootPub := s.createKey(data.CanonicalRootRole)
+	priv, _, err := s.keys.GetPrivateKey(rootPub.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := cryptoservice.GenerateCertificate(priv, testGUN, time.Now(), time.Now().AddDate(10, 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootKey := data.NewECDSAx509PublicKey(trustmanager.CertToPEM(cert))
+	s.RootKeyID, s.RootCanonicalID, s.RootCert = rootKey.ID(), rootPub.ID(), cert
+
+	s.repo = tuf.NewRepo(s.keys)
+	err = s.repo.InitRoot(
+		data.NewBaseRole(data.CanonicalRootRole, 1, rootKey),
+		data.NewBaseRole(data.CanonicalTimestampRole, 1, s.createKey(data.CanonicalTimestampRole)),
+		data.NewBaseRole(data.CanonicalSnapshotRole, 1, s.createKey(data.CanonicalSnapshotRole)),
+		data.NewBaseRole(data.CanonicalTargetsRole, 1, s.createKey(data.CanonicalTargetsRole)),
+		false,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.repo.InitTargets(data.CanonicalTargetsRole); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.repo.InitSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.repo.InitTimestamp(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.repo.SignRoot(data.DefaultExpires(data.CanonicalRootRole)); err != nil {
+		t.Fatal(err)
+	}
+	s.publish()
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+func (s *testServer) createKey(role string) data.PublicKey {
+	key, err := s.keys.Create(role, data.ECDSAKey)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return key
+}
+
+func (s *testServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prefix := "/v2/" + testGUN + "/_trust/tuf"
+	if r.Method == "POST" && strings.TrimSuffix(r.URL.Path, "/") == prefix {
+		if err := s.push(r); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+	role := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, prefix+"/"), ".json")
+	b, ok := s.meta[role]
+	if r.Method != "GET" || !strings.HasPrefix(r.URL.Path, prefix+"/") || !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Write(b)
+}
+
+// push accepts targets metadata for delegations the server holds no keys
+// of, if it meets the delegation's threshold, and serves it with a new
+// snapshot and timestamp. The snapshot uploaded with it is ignored.
+func (s *testServer) push(r *http.Request) error {
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		return err
+	}
+	for _, fh := range r.MultipartForm.File["files"] {
+		// the parsed file name drops the role's directory
+		_, params, err := mime.ParseMediaType(fh.Header.Get("Content-Disposition"))
+		if err != nil {
+			return err
+		}
+		role := params["filename"]
+		if role == data.CanonicalSnapshotRole {
+			continue
+		}
+		d, err := s.repo.GetDelegationRole(role)
+		if err != nil {
+			return err
+		}
+		f, err := fh.Open()
+		if err != nil {
+			return err
+		}
+		meta := &data.Signed{}
+		err = json.NewDecoder(f).Decode(meta)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		t, err := data.TargetsFromSigned(meta, role)
+		if err != nil {
+			return err
+		}
+		if err := signed.Verify(meta, d.BaseRole, t.Signed.Version); err != nil {
+			return err
+		}
+		s.pushed[role] = meta
+	}
+	return s.sign()
+}
+
+// testMeta returns the target metadata of app, with testManifest as its
+// manifest.
+func testMeta(t *testing.T, app string) data.FileMeta {
+	m, err := manifest.Parse([]byte(testManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	custom, err := m.Custom()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte(app))
+	return data.FileMeta{
+		Length: 10,
+		Hashes: data.Hashes{"sha256": sum[:]},
+		Custom: custom,
+	}
+}
+
+// addTarget adds the app to role's targets, signed by the server. It is
+// served on the next publish.
+func (s *testServer) addTarget(role, app string) {
+	if _, ok := s.repo.Targets[role]; !ok {
+		if _, err := s.repo.InitTargets(role); err != nil {
+			s.t.Fatal(err)
+		}
+	}
+	if _, err := s.repo.AddTargets(role, data.Files{app: testMeta(s.t, app)}); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+// addDelegation delegates role to keys with the given threshold and paths.
+// It is served on the next publish.
+func (s *testServer) addDelegation(role string, keys data.KeyList, threshold int, paths ...string) {
+	if err := s.repo.UpdateDelegationKeys(role, keys, nil, threshold); err != nil {
+		s.t.Fatal(err)
+	}
+	if err := s.repo.UpdateDelegationPaths(role, paths, nil, false); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+// publish signs a new version of every targets role the server signs, the
+// snapshot and the timestamp, and serves them.
+func (s *testServer) publish() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.sign(); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+func (s *testServer) sign() error {
+	for role := range s.repo.Targets {
+		if _, err := s.repo.SignTargets(role, data.DefaultExpires(data.CanonicalTargetsRole)); err != nil {
+			return err
+		}
+	}
+	for role, meta := range s.pushed {
+		if err := s.repo.UpdateSnapshot(role, meta); err != nil {
+			return err
+		}
+	}
+	if _, err := s.repo.SignSnapshot(data.DefaultExpires(data.CanonicalSnapshotRole)); err != nil {
+		return err
+	}
+	if _, err := s.repo.SignTimestamp(data.DefaultExpires(data.CanonicalTimestampRole)); err != nil {
+		return err
+	}
+
+	all := map[string]*data.Signed{}
+	for role, m := range map[string]interface {
+		ToSigned() (*data.Signed, error)
+	}{
+		data.CanonicalRootRole:      s.repo.Root,
+		data.CanonicalSnapshotRole:  s.repo.Snapshot,
+		data.CanonicalTimestampRole: s.repo.Timestamp,
+	} {
+		sig, err := m.ToSigned()
+		if err != nil {
+			return err
+		}
+		all[role] = sig
+	}
+	for role, t := range s.repo.Targets {
+		sig, err := t.ToSigned()
+		if err != nil {
+			return err
+		}
+		all[role] = sig
+	}
+	for role, meta := range s.pushed {
+		all[role] = meta
+	}
+	meta := make(map[string][]byte)
+	for role, sig := range all {
+		b, err := json.Marshal(sig)
+		if err != nil {
+			return err
+		}
+		// the client asks for metadata by checksum when it knows it
+		sum := sha256.Sum256(b)
+		meta[role], meta[role+"."+hex.EncodeToString(sum[:])] = b, b
+	}
+	s.meta = meta
+	return nil
+}
+
+// testCatalog opens the test server's catalog with a fresh cache, which
+// must be removed with os.RemoveAll(c.TrustDir).
+func testCatalog(t *testing.T, s *testServer) *Catalog {
+	dir, err := ioutil.TempDir("", "catalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := Open(dir, s.URL, testGUN, http.DefaultTransport, testRetriever)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestLookup(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	s.addTarget(data.CanonicalTargetsRole, "atom")
+	s.addDelegation("targets/sky", data.KeyList{s.createKey("targets/sky")}, 1, "sky")
+	s.addTarget("targets/sky", "skype")
+	s.publish()
+
+	c := testCatalog(t, s)
+	defer os.RemoveAll(c.TrustDir)
+
+	app, err := c.Lookup("atom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if app.Role != data.CanonicalTargetsRole || app.Manifest.Run.Image != "conman/apps:atom" {
+		t.Errorf("got %s signed by %s", app.Name, app.Role)
+	}
+	if _, err := c.Lookup("gimp"); err != (ErrAppNotFound{Name: "gimp"}) {
+		t.Errorf("looking up a missing app: %v", err)
+	}
+	// TUF accepts skype under the sky prefix, conman does not
+	if _, err := c.Lookup("skype"); err == nil || !strings.Contains(err.Error(), "may not sign") {
+		t.Errorf("looking up an app signed by a publisher of another: %v", err)
+	}
+}
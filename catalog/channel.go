@@ -0,0 +1,159 @@
+package catalog
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/notary/tuf/data"
+	"github.com/riyazdf/notary/client"
+)
+
+// Release channels.
+const (
+	Stable  = "stable"
+	Beta    = "beta"
+	Nightly = "nightly"
+)
+
+// Channels lists the release channels from most to least stable. Each
+// channel falls back to the channels before it for apps it does not carry.
+var Channels = []string{Stable, Beta, Nightly}
+
+// channelRoles maps each channel to the delegation its targets are signed
+// in. Stable targets may also be signed in the base targets role.
+var channelRoles = map[string]string{
+	Stable:  data.CanonicalTargetsRole + "/releases",
+	Beta:    data.CanonicalTargetsRole + "/beta",
+	Nightly: data.CanonicalTargetsRole + "/nightly",
+}
+
+// ErrUnknownChannel is returned for channels not in Channels.
+type ErrUnknownChannel struct {
+	Channel string
+}
+
+func (err ErrUnknownChannel) Error() string {
+	return fmt.Sprintf("unknown channel %q, expected one of %s", err.Channel, strings.Join(Channels, ", "))
+}
+
+// ChannelRole returns the delegation role the channel's targets are signed
+// in. The empty channel is Stable.
+func ChannelRole(channel string) (string, error) {
+	if channel == "" {
+		channel = Stable
+	}
+	role, ok := channelRoles[channel]
+	if !ok {
+		return "", ErrUnknownChannel{Channel: channel}
+	}
+	return role, nil
+}
+
+// isChannelRole reports whether role is, or is delegated from, a channel
+// delegation.
+func isChannelRole(role string) bool {
+	for _, r := range channelRoles {
+		if role == r || strings.HasPrefix(role, r+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// searchRoles returns the roles to pass to the notary client's target
+// lookups for channel, in descending priority: the channel's delegation,
+// those of the more stable channels, and the base targets role. The
+// delegations of less stable channels come last, only so the walk of the
+// base targets role skips them; targets found in them are discarded by
+// onChannel.
+func searchRoles(channel string) ([]string, error) {
+	if _, err := ChannelRole(channel); err != nil {
+		return nil, err
+	}
+	if channel == "" {
+		channel = Stable
+	}
+	var include, exclude []string
+	included := true
+	for _, ch := range Channels {
+		if included {
+			include = append([]string{channelRoles[ch]}, include...)
+		} else {
+			exclude = append(exclude, channelRoles[ch])
+		}
+		if ch == channel {
+			included = false
+		}
+	}
+	roles := append(include, data.CanonicalTargetsRole)
+	return append(roles, exclude...), nil
+}
+
+// onChannel reports whether a target signed by role belongs on channel.
+func onChannel(channel, role string) bool {
+	if channel == "" {
+		channel = Stable
+	}
+	for _, ch := range Channels {
+		r := channelRoles[ch]
+		if role == r || strings.HasPrefix(role, r+"/") {
+			return true
+		}
+		if ch == channel {
+			break
+		}
+	}
+	return !isChannelRole(role)
+}
+
+// AddChannel stages the creation of the channel's delegation, or adds keys
+// to an existing one. Channel delegations may sign any app. A new
+// delegation with a threshold above one needs that many of its keys to
+// sign, through a Bundle. The changes are pushed by a subsequent
+// NotaryRepository.Publish.
+func (c *Catalog) AddChannel(channel string, keys []data.PublicKey, threshold int) error {
+	role, err := ChannelRole(channel)
+	if err != nil {
+		return err
+	}
+	return c.addDelegation(role, keys, []string{""}, threshold)
+}
+
+// RemoveChannel stages the removal of the channel's delegation.
+func (c *Catalog) RemoveChannel(channel string) error {
+	role, err := ChannelRole(channel)
+	if err != nil {
+		return err
+	}
+	return c.Repo.RemoveDelegationRole(role)
+}
+
+// PublishedTargets returns the published targets a publish to role is
+// compared with: those signed in role itself and, unless role is a channel
+// delegation, those signed in the base targets role or a publisher
+// delegation, which a publish to role moves. Targets on channels are only
+// compared with publishes to their own channel, so publishing elsewhere
+// never removes them.
+func (c *Catalog) PublishedTargets(role string) ([]*client.TargetWithRole, error) {
+	roles := []string{role}
+	if role != data.CanonicalTargetsRole && !isChannelRole(role) {
+		roles = append(roles, data.CanonicalTargetsRole)
+	}
+	targets, err := c.Repo.ListTargets(roles...)
+	if err != nil {
+		return nil, err
+	}
+	return publishedIn(role, targets), nil
+}
+
+// publishedIn filters the targets listed for a publish to role as
+// PublishedTargets describes.
+func publishedIn(role string, targets []*client.TargetWithRole) []*client.TargetWithRole {
+	var out []*client.TargetWithRole
+	for _, t := range targets {
+		if t.Role == role || !isChannelRole(role) && !isChannelRole(t.Role) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
@@ -0,0 +1,37 @@
+package catalog
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/riyazdf/notary/client"
+)
+
+func TestPublishedIn(t *testing.T) {
+	targets := []*client.TargetWithRole{
+		{Target: client.Target{Name: "atom"}, Role: "targets"},
+		{Target: client.Target{Name: "spotify"}, Role: "targets/spotify-team"},
+		{Target: client.Target{Name: "slack"}, Role: "targets/beta"},
+		{Target: client.Target{Name: "skype"}, Role: "targets/nightly"},
+		{Target: client.Target{Name: "cheese"}, Role: "targets/releases"},
+	}
+	for _, tt := range []struct {
+		role string
+		want []string
+	}{
+		{"targets", []string{"atom", "spotify"}},
+		{"targets/spotify-team", []string{"atom", "spotify"}},
+		{"targets/beta", []string{"slack"}},
+		{"targets/releases", []string{"cheese"}},
+	} {
+		var got []string
+		for _, t := range publishedIn(tt.role, targets) {
+			got = append(got, t.Name)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("publishing to %s compares with %v, want %v", tt.role, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package catalog
+
+import (
+	"archive/zip"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/docker/notary"
+	"github.com/docker/notary/cryptoservice"
+	"github.com/docker/notary/passphrase"
+	"github.com/docker/notary/trustmanager"
+	"github.com/docker/notary/tuf/data"
+)
+
+// maxKeySize limits the size of a key read from an archive.
+const maxKeySize = 1 << 20
+
+// ArchivedKey describes a private key in a key archive.
+type ArchivedKey struct {
+	ID   string
+	Role string
+	// GUN is the collection the key signs for, empty for root keys, which
+	// are not tied to one.
+	GUN string
+}
+
+// cryptoService returns the repository's file backed crypto service, which
+// keys are exported from and imported into.
+func (c *Catalog) cryptoService() (*cryptoservice.CryptoService, error) {
+	cs, ok := c.Repo.CryptoService.(*cryptoservice.CryptoService)
+	if !ok {
+		return nil, errors.New("the catalog's keys are not stored in files and cannot be exported or imported")
+	}
+	return cs, nil
+}
+
+// ExportKeys writes a zip archive of the catalog's signing keys to w, or of
+// every key including root keys if all is set. Each key is re-encrypted
+// with a passphrase from newPassphrase.
+func (c *Catalog) ExportKeys(w io.Writer, all bool, newPassphrase passphrase.Retriever) error {
+	cs, err := c.cryptoService()
+	if err != nil {
+		return err
+	}
+	if all {
+		return cs.ExportAllKeys(w, newPassphrase)
+	}
+	return cs.ExportKeysByGUN(w, c.GUN, newPassphrase)
+}
+
+// CheckKeyArchive checks every key in a zip archive written by ExportKeys
+// before it is imported: that it is stored where its role belongs, that its
+// role is one the catalog uses, and that it decrypts, with a passphrase from
+// retriever, to the key its file is named after. Root keys must be
+// encrypted. Unless all is set, only the catalog's keys are allowed.
+func (c *Catalog) CheckKeyArchive(zr *zip.Reader, all bool, retriever passphrase.Retriever) ([]ArchivedKey, error) {
+	var keys []ArchivedKey
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		key, err := c.checkArchivedKey(f, all, retriever)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.Name, err)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("the archive holds no keys")
+	}
+	sort.Sort(byKeyRole(keys))
+	return keys, nil
+}
+
+func (c *Catalog) checkArchivedKey(f *zip.File, all bool, retriever passphrase.Retriever) (ArchivedKey, error) {
+	name := f.Name
+	if path.Clean(name) != name || path.IsAbs(name) || strings.HasPrefix(name, "../") {
+		return ArchivedKey{}, errors.New("invalid path in archive")
+	}
+	if path.Ext(name) != ".key" {
+		return ArchivedKey{}, errors.New("not a key file")
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return ArchivedKey{}, err
+	}
+	pemBytes, err := ioutil.ReadAll(io.LimitReader(rc, maxKeySize))
+	rc.Close()
+	if err != nil {
+		return ArchivedKey{}, err
+	}
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return ArchivedKey{}, errors.New("not a PEM encoded key")
+	}
+
+	key := ArchivedKey{
+		ID:   strings.TrimSuffix(path.Base(name), ".key"),
+		Role: block.Headers["role"],
+	}
+	switch dir := path.Dir(name); {
+	case dir == notary.RootKeysSubdir:
+		if key.Role != data.CanonicalRootRole {
+			return key, fmt.Errorf("%s key stored as a root key", describeRole(key.Role))
+		}
+		if !x509.IsEncryptedPEMBlock(block) {
+			return key, cryptoservice.ErrRootKeyNotEncrypted
+		}
+		if !all {
+			return key, errors.New("root keys are only imported with all keys")
+		}
+	case strings.HasPrefix(dir, notary.NonRootKeysSubdir+"/"):
+		key.GUN = strings.TrimPrefix(dir, notary.NonRootKeysSubdir+"/")
+		if !signingRole(key.Role) {
+			return key, fmt.Errorf("%s key stored as a signing key for %s", describeRole(key.Role), key.GUN)
+		}
+		if key.GUN != c.GUN && !all {
+			return key, fmt.Errorf("key for %s, not %s", key.GUN, c.GUN)
+		}
+	default:
+		return key, errors.New("not in a key directory")
+	}
+
+	priv, err := trustmanager.ParsePEMPrivateKey(pemBytes, "")
+	if err != nil {
+		if priv, _, err = trustmanager.GetPasswdDecryptBytes(retriever, pemBytes, key.ID, key.Role); err != nil {
+			return key, err
+		}
+	}
+	if priv.ID() != key.ID {
+		return key, fmt.Errorf("file name does not match key ID %s", priv.ID())
+	}
+	return key, nil
+}
+
+// ImportKeys checks the keys in a zip archive written by ExportKeys, as by
+// CheckKeyArchive, and only if all of them pass adds them to the catalog's
+// key store, keeping the passphrases they were exported with.
+func (c *Catalog) ImportKeys(zr *zip.Reader, all bool, retriever passphrase.Retriever) ([]ArchivedKey, error) {
+	cs, err := c.cryptoService()
+	if err != nil {
+		return nil, err
+	}
+	keys, err := c.CheckKeyArchive(zr, all, retriever)
+	if err != nil {
+		return nil, err
+	}
+	// ImportKeysZip takes the reader by value; only its files are needed
+	if err := cs.ImportKeysZip(zip.Reader{File: zr.File}); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// signingRole reports whether role is a role other than root a catalog's
+// keys sign for.
+func signingRole(role string) bool {
+	switch role {
+	case data.CanonicalTargetsRole, data.CanonicalSnapshotRole, data.CanonicalTimestampRole:
+		return true
+	}
+	return data.IsDelegation(role)
+}
+
+func describeRole(role string) string {
+	if role == "" {
+		return "unlabelled"
+	}
+	return role
+}
+
+type byKeyRole []ArchivedKey
+
+func (k byKeyRole) Len() int      { return len(k) }
+func (k byKeyRole) Swap(i, j int) { k[i], k[j] = k[j], k[i] }
+func (k byKeyRole) Less(i, j int) bool {
+	if k[i].GUN != k[j].GUN {
+		return k[i].GUN < k[j].GUN
+	}
+	if k[i].Role != k[j].Role {
+		return k[i].Role < k[j].Role
+	}
+	return k[i].ID < k[j].ID
+}
@@ -0,0 +1,190 @@
+package catalog
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/pem"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/docker/notary"
+	"github.com/docker/notary/tuf/data"
+)
+
+// createKeys creates a key for each role in the catalog's key store and
+// returns the keys, sorted as CheckKeyArchive sorts them.
+func createKeys(t *testing.T, c *Catalog, roles ...string) []ArchivedKey {
+	var keys []ArchivedKey
+	for _, role := range roles {
+		pub, err := c.Repo.CryptoService.Create(role, data.ECDSAKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key := ArchivedKey{ID: pub.ID(), Role: role, GUN: c.GUN}
+		if role == data.CanonicalRootRole {
+			key.GUN = ""
+		}
+		keys = append(keys, key)
+	}
+	sort.Sort(byKeyRole(keys))
+	return keys
+}
+
+// exportKeys returns the files of the catalog's key archive by name.
+func exportKeys(t *testing.T, c *Catalog, all bool) map[string][]byte {
+	var buf bytes.Buffer
+	if err := c.ExportKeys(&buf, all, testRetriever); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string][]byte)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b bytes.Buffer
+		_, err = b.ReadFrom(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = b.Bytes()
+	}
+	return files
+}
+
+func keyArchive(t *testing.T, files map[string][]byte) *zip.Reader {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, b := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zr
+}
+
+// keyFile returns the name and contents of the archived key with the given
+// role.
+func keyFile(t *testing.T, files map[string][]byte, role string) (string, []byte) {
+	for name, b := range files {
+		if block, _ := pem.Decode(b); block != nil && block.Headers["role"] == role {
+			return name, b
+		}
+	}
+	t.Fatalf("no %s key in %v", role, files)
+	return "", nil
+}
+
+func TestExportImportKeys(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	src := testCatalog(t, s)
+	defer os.RemoveAll(src.TrustDir)
+	signing := createKeys(t, src, data.CanonicalTargetsRole, data.CanonicalSnapshotRole, "targets/releases")
+	root := createKeys(t, src, data.CanonicalRootRole)
+
+	for _, tt := range []struct {
+		name        string
+		export, all bool
+		want        []ArchivedKey
+		err         string
+	}{
+		{name: "signing keys", want: signing},
+		{name: "all keys", export: true, all: true, want: append(append([]ArchivedKey(nil), root...), signing...)},
+		{name: "root keys without all", export: true, err: "root keys are only imported with all keys"},
+	} {
+		dst := testCatalog(t, s)
+		zr := keyArchive(t, exportKeys(t, src, tt.export))
+		keys, err := dst.ImportKeys(zr, tt.all, testRetriever)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: ImportKeys = %v, want %q", tt.name, err, tt.err)
+			}
+			for _, k := range append(root, signing...) {
+				if _, _, err := dst.Repo.CryptoService.GetPrivateKey(k.ID); err == nil {
+					t.Errorf("%s: %s key imported from a rejected archive", tt.name, k.Role)
+				}
+			}
+		} else if err != nil {
+			t.Errorf("%s: ImportKeys = %v", tt.name, err)
+		} else {
+			if !reflect.DeepEqual(keys, tt.want) {
+				t.Errorf("%s: imported %v, want %v", tt.name, keys, tt.want)
+			}
+			for _, k := range keys {
+				if _, role, err := dst.Repo.CryptoService.GetPrivateKey(k.ID); err != nil || role != k.Role {
+					t.Errorf("%s: imported %s key: %s, %v", tt.name, k.Role, role, err)
+				}
+			}
+		}
+		os.RemoveAll(dst.TrustDir)
+	}
+}
+
+func TestCheckKeyArchive(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	src := testCatalog(t, s)
+	defer os.RemoveAll(src.TrustDir)
+	createKeys(t, src, data.CanonicalRootRole, data.CanonicalTargetsRole)
+	exported := exportKeys(t, src, true)
+	targetsName, targetsKey := keyFile(t, exported, data.CanonicalTargetsRole)
+	rootName, rootKey := keyFile(t, exported, data.CanonicalRootRole)
+	relabel := func(b []byte, role string) []byte {
+		block, _ := pem.Decode(b)
+		block.Headers["role"] = role
+		return pem.EncodeToMemory(block)
+	}
+	otherGUN := path.Join(notary.NonRootKeysSubdir, "docker.io/other/apps", path.Base(targetsName))
+
+	for _, tt := range []struct {
+		name  string
+		files map[string][]byte
+		err   string
+	}{
+		{"empty", map[string][]byte{}, "holds no keys"},
+		{"parent directory", map[string][]byte{"../" + targetsName: targetsKey}, "invalid path"},
+		{"absolute", map[string][]byte{"/" + targetsName: targetsKey}, "invalid path"},
+		{"unclean", map[string][]byte{notary.NonRootKeysSubdir + "/../../" + path.Base(targetsName): targetsKey}, "invalid path"},
+		{"not a key", map[string][]byte{"README.txt": []byte("hello")}, "not a key file"},
+		{"outside the key directories", map[string][]byte{"keys/" + path.Base(targetsName): targetsKey}, "not in a key directory"},
+		{"not PEM", map[string][]byte{targetsName: []byte("garbage")}, "not a PEM encoded key"},
+		{"root key as a signing key", map[string][]byte{path.Join(path.Dir(targetsName), path.Base(rootName)): rootKey}, "root key stored as a signing key"},
+		{"signing key as a root key", map[string][]byte{path.Join(path.Dir(rootName), path.Base(targetsName)): targetsKey}, "targets key stored as a root key"},
+		{"unlabelled", map[string][]byte{targetsName: relabel(targetsKey, "")}, "unlabelled key"},
+		{"renamed", map[string][]byte{path.Join(path.Dir(targetsName), "0123.key"): targetsKey}, "does not match"},
+		{"other catalog", map[string][]byte{otherGUN: targetsKey}, "key for docker.io/other/apps"},
+		// one bad entry rejects the whole archive
+		{"mixed", map[string][]byte{targetsName: targetsKey, "../evil.key": targetsKey}, "invalid path"},
+	} {
+		_, err := src.CheckKeyArchive(keyArchive(t, tt.files), false, testRetriever)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: CheckKeyArchive = %v, want %q", tt.name, err, tt.err)
+		}
+	}
+
+	keys, err := src.CheckKeyArchive(keyArchive(t, map[string][]byte{otherGUN: targetsKey}), true, testRetriever)
+	if err != nil || len(keys) != 1 || keys[0].GUN != "docker.io/other/apps" {
+		t.Errorf("CheckKeyArchive with all keys of another catalog = %v, %v", keys, err)
+	}
+}
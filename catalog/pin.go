@@ -0,0 +1,245 @@
+package catalog
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/notary/trustmanager"
+	"github.com/docker/notary/tuf/data"
+	"github.com/docker/notary/tuf/utils"
+)
+
+// Pin is the root of trust expected for a catalog, as the IDs of the keys
+// allowed to be root keys and certificates signing the root. A root is
+// accepted if every one of its root keys is pinned.
+type Pin struct {
+	// RootKeys are root key IDs, either as listed in root.json or the
+	// canonical IDs shown by notary key list.
+	RootKeys []string `json:"root_keys"`
+	// Certs are PEM files of root certificates, whose common name must be
+	// the catalog's GUN.
+	Certs []string `json:"certs"`
+}
+
+// ErrRootNotPinned is returned when the catalog's root is signed with keys
+// the pin does not allow.
+type ErrRootNotPinned struct {
+	GUN string
+	// KeyIDs are the root's keys that are not pinned.
+	KeyIDs []string
+	// Rotated is set if a previously trusted root was replaced.
+	Rotated bool
+}
+
+func (err ErrRootNotPinned) Error() string {
+	if err.Rotated {
+		return fmt.Sprintf("the root of trust for %s was rotated to keys that are not pinned (%s); if the rotation is legitimate, update the pin and run conman trust reset", err.GUN, strings.Join(err.KeyIDs, ", "))
+	}
+	return fmt.Sprintf("the root of trust for %s is signed with keys that are not pinned (%s), refusing to trust it", err.GUN, strings.Join(err.KeyIDs, ", "))
+}
+
+// keyIDs returns the key IDs the pin allows, including those of its
+// certificates.
+func (p *Pin) keyIDs() (map[string]bool, error) {
+	ids := make(map[string]bool)
+	for _, id := range p.RootKeys {
+		ids[id] = true
+	}
+	certs, err := p.loadCerts()
+	if err != nil {
+		return nil, err
+	}
+	for _, cert := range certs {
+		key := trustmanager.CertToKey(cert)
+		ids[key.ID()] = true
+		if id, err := utils.CanonicalKeyID(key); err == nil {
+			ids[id] = true
+		}
+	}
+	return ids, nil
+}
+
+// RootKeyIDs returns the root key IDs of the catalog's cached root, or nil
+// if no root is cached. The root is not verified.
+func (c *Catalog) RootKeyIDs() ([]string, error) {
+	root, err := c.cachedRoot()
+	if err != nil || root == nil {
+		return nil, err
+	}
+	role, ok := root.Signed.Roles[data.CanonicalRootRole]
+	if !ok || role == nil {
+		return nil, fmt.Errorf("cached root for %s has no root role", c.GUN)
+	}
+	ids := append([]string(nil), role.KeyIDs...)
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// cachedRoot returns the catalog's cached root, or nil if none is cached.
+func (c *Catalog) cachedRoot() (*data.SignedRoot, error) {
+	b, err := ioutil.ReadFile(filepath.Join(c.metadataDir(), data.CanonicalRootRole+".json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	root := &data.SignedRoot{}
+	if err := json.Unmarshal(b, root); err != nil {
+		return nil, fmt.Errorf("cached root for %s is corrupt: %v", c.GUN, err)
+	}
+	return root, nil
+}
+
+// Verify checks the catalog's trust data before use: the root against the
+// pin, and the metadata versions against the version log.
+func (c *Catalog) Verify() error {
+	if c.Pin != nil {
+		if err := c.verifyPin(); err != nil {
+			return err
+		}
+	}
+	return c.CheckVersions(time.Now())
+}
+
+// verifyPin bootstraps the catalog's trust data and checks its root against
+// the pin. Pinned certificates are added to the certificate store first, so
+// the notary client itself rejects a root they do not sign. A root fetched
+// for the first time that does not match the pin is deleted; a cached root
+// that no longer matches, after a rotation, is kept until conman trust reset
+// replaces it.
+func (c *Catalog) verifyPin() error {
+	if err := c.trustPinnedCerts(); err != nil {
+		return err
+	}
+	prev, err := c.cachedRoot()
+	if err != nil {
+		return err
+	}
+	// a failed update is reported by whatever uses the catalog next
+	c.Repo.Update(false)
+
+	err = c.checkPin(prev != nil)
+	if _, ok := err.(ErrRootNotPinned); ok && prev == nil {
+		if derr := c.Repo.DeleteTrustData(); derr != nil {
+			return fmt.Errorf("%v, and deleting it failed: %v", err, derr)
+		}
+	}
+	return err
+}
+
+// Reset replaces the catalog's trust data with a fresh copy from the
+// server, verified against the pin, forgetting the metadata versions seen
+// before if forgetVersions is set. Metadata older than the versions kept is
+// deleted rather than left behind for offline use.
+func (c *Catalog) Reset(forgetVersions bool) error {
+	if err := c.Repo.DeleteTrustData(); err != nil {
+		return err
+	}
+	if forgetVersions && c.Versions != nil {
+		c.Versions.Forget(c.GUN)
+		if err := c.Versions.Save(); err != nil {
+			return err
+		}
+	}
+	if err := c.Verify(); err != nil {
+		return err
+	}
+	if _, err := c.Repo.Update(false); err != nil {
+		return err
+	}
+	err := c.CheckVersions(time.Now())
+	if _, ok := err.(ErrRollback); ok {
+		if derr := c.Repo.DeleteTrustData(); derr != nil {
+			return fmt.Errorf("%v, and deleting it failed: %v", err, derr)
+		}
+	}
+	return err
+}
+
+// checkPin checks the cached root against the pin. A missing root passes,
+// as there is nothing to trust yet. rotated is set if the root was trusted
+// before, and so can only have changed by rotation.
+func (c *Catalog) checkPin(rotated bool) error {
+	if c.Pin == nil {
+		return nil
+	}
+	root, err := c.cachedRoot()
+	if err != nil || root == nil {
+		return err
+	}
+	pinned, err := c.Pin.keyIDs()
+	if err != nil {
+		return err
+	}
+	role, ok := root.Signed.Roles[data.CanonicalRootRole]
+	if !ok || role == nil {
+		return fmt.Errorf("cached root for %s has no root role", c.GUN)
+	}
+	var unpinned []string
+	for _, id := range role.KeyIDs {
+		if pinned[id] {
+			continue
+		}
+		if key, ok := root.Signed.Keys[id]; ok {
+			if cid, err := utils.CanonicalKeyID(key); err == nil && pinned[cid] {
+				continue
+			}
+		}
+		unpinned = append(unpinned, id)
+	}
+	if len(unpinned) > 0 {
+		sort.Strings(unpinned)
+		return ErrRootNotPinned{GUN: c.GUN, KeyIDs: unpinned, Rotated: rotated}
+	}
+	return nil
+}
+
+// trustPinnedCerts adds the pinned certificates to the certificate store if
+// it has none for the catalog yet.
+func (c *Catalog) trustPinnedCerts() error {
+	certs, err := c.Pin.loadCerts()
+	if err != nil || len(certs) == 0 {
+		return err
+	}
+	trusted, err := c.Repo.CertStore.GetCertificatesByCN(c.GUN)
+	if err != nil {
+		if _, ok := err.(*trustmanager.ErrNoCertificatesFound); !ok {
+			return err
+		}
+	}
+	if len(trusted) > 0 {
+		return nil
+	}
+	for _, cert := range certs {
+		if cert.Subject.CommonName != c.GUN {
+			return fmt.Errorf("pinned certificate for %s has common name %q", c.GUN, cert.Subject.CommonName)
+		}
+		if err := c.Repo.CertStore.AddCert(cert); err != nil {
+			if _, ok := err.(*trustmanager.ErrCertExists); !ok {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// loadCerts reads the pinned certificates.
+func (p *Pin) loadCerts() ([]*x509.Certificate, error) {
+	certs := make([]*x509.Certificate, 0, len(p.Certs))
+	for _, path := range p.Certs {
+		cert, err := trustmanager.LoadCertFromFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("loading pinned certificate %s: %v", path, err)
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
@@ -0,0 +1,187 @@
+package catalog
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/notary/trustmanager"
+	"github.com/docker/notary/tuf/data"
+)
+
+// writeCert writes the server's root certificate as a PEM file under dir.
+func writeCert(t *testing.T, s *testServer, dir string) string {
+	path := filepath.Join(dir, "root.crt")
+	if err := ioutil.WriteFile(path, trustmanager.CertToPEM(s.RootCert), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCheckPin(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	c := testCatalog(t, s)
+	defer os.RemoveAll(c.TrustDir)
+	if _, err := c.Repo.Update(false); err != nil {
+		t.Fatal(err)
+	}
+	cert := writeCert(t, s, c.TrustDir)
+
+	for _, tt := range []struct {
+		name    string
+		pin     *Pin
+		rotated bool
+		err     error
+	}{
+		{name: "no pin"},
+		{name: "root.json key ID", pin: &Pin{RootKeys: []string{s.RootKeyID}}},
+		{name: "canonical key ID", pin: &Pin{RootKeys: []string{s.RootCanonicalID}}},
+		{name: "certificate", pin: &Pin{Certs: []string{cert}}},
+		{name: "one of several", pin: &Pin{RootKeys: []string{"0123", s.RootKeyID}}},
+		{
+			name: "other key",
+			pin:  &Pin{RootKeys: []string{"0123"}},
+			err:  ErrRootNotPinned{GUN: testGUN, KeyIDs: []string{s.RootKeyID}},
+		},
+		{
+			name:    "other key after rotation",
+			pin:     &Pin{RootKeys: []string{"0123"}},
+			rotated: true,
+			err:     ErrRootNotPinned{GUN: testGUN, KeyIDs: []string{s.RootKeyID}, Rotated: true},
+		},
+	} {
+		c.Pin = tt.pin
+		if err := c.checkPin(tt.rotated); !reflect.DeepEqual(err, tt.err) {
+			t.Errorf("%s: checkPin = %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestCheckPinNoRoot(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	c := testCatalog(t, s)
+	defer os.RemoveAll(c.TrustDir)
+	c.Pin = &Pin{RootKeys: []string{"0123"}}
+	if err := c.checkPin(false); err != nil {
+		t.Errorf("checkPin with nothing cached = %v", err)
+	}
+}
+
+func TestCheckPinNoRootRole(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	c := testCatalog(t, s)
+	defer os.RemoveAll(c.TrustDir)
+	if _, err := c.Repo.Update(false); err != nil {
+		t.Fatal(err)
+	}
+	root, err := c.cachedRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, role := range []*data.RootRole{nil, {}} {
+		if role == nil {
+			root.Signed.Roles[data.CanonicalRootRole] = nil
+		} else {
+			delete(root.Signed.Roles, data.CanonicalRootRole)
+		}
+		b, err := json.Marshal(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(c.metadataDir(), data.CanonicalRootRole+".json"), b, 0600); err != nil {
+			t.Fatal(err)
+		}
+		c.Pin = &Pin{RootKeys: []string{s.RootKeyID}}
+		if err := c.checkPin(true); err == nil || !strings.Contains(err.Error(), "has no root role") {
+			t.Errorf("checkPin with no root role = %v", err)
+		}
+		if _, err := c.RootKeyIDs(); err == nil {
+			t.Error("RootKeyIDs with no root role succeeded")
+		}
+	}
+}
+
+func TestVerifyPin(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+
+	// a root that does not match the pin on first use is not kept
+	c := testCatalog(t, s)
+	defer os.RemoveAll(c.TrustDir)
+	c.Pin = &Pin{RootKeys: []string{"0123"}}
+	want := ErrRootNotPinned{GUN: testGUN, KeyIDs: []string{s.RootKeyID}}
+	if err := c.Verify(); !reflect.DeepEqual(err, want) {
+		t.Fatalf("Verify on first use = %v, want %v", err, want)
+	}
+	if root, err := c.cachedRoot(); err != nil || root != nil {
+		t.Errorf("unpinned root was kept: %v", err)
+	}
+
+	// one that does is, and is reported as rotated once the pin changes
+	c.Pin = &Pin{RootKeys: []string{s.RootCanonicalID}}
+	if err := c.Verify(); err != nil {
+		t.Fatalf("Verify with the root pinned = %v", err)
+	}
+	c.Pin = &Pin{RootKeys: []string{"0123"}}
+	want.Rotated = true
+	if err := c.Verify(); !reflect.DeepEqual(err, want) {
+		t.Fatalf("Verify after rotation = %v, want %v", err, want)
+	}
+	if root, err := c.cachedRoot(); err != nil || root == nil {
+		t.Errorf("trusted root was deleted after rotation: %v", err)
+	}
+}
+
+func TestReset(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	c := testCatalog(t, s)
+	defer os.RemoveAll(c.TrustDir)
+	var err error
+	if c.Versions, err = OpenVersionLog(filepath.Join(c.TrustDir, "versions.json")); err != nil {
+		t.Fatal(err)
+	}
+	c.Pin = &Pin{RootKeys: []string{s.RootKeyID}}
+	if err := c.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Repo.Update(false); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CheckVersions(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	before := *c.Versions.Get(testGUN)
+
+	// resetting to a pin the root does not match leaves no trust data
+	c.Pin = &Pin{RootKeys: []string{"0123"}}
+	if _, ok := c.Reset(false).(ErrRootNotPinned); !ok {
+		t.Fatal("Reset trusted a root that is not pinned")
+	}
+	if root, err := c.cachedRoot(); err != nil || root != nil {
+		t.Errorf("unpinned root was kept by Reset: %v", err)
+	}
+	if v := c.Versions.Get(testGUN); v == nil || *v != before {
+		t.Errorf("Reset without forgetting versions changed them to %+v", v)
+	}
+
+	c.Pin = &Pin{RootKeys: []string{s.RootKeyID}}
+	if err := c.Reset(true); err != nil {
+		t.Fatalf("Reset with the root pinned = %v", err)
+	}
+	if root, err := c.cachedRoot(); err != nil || root == nil {
+		t.Errorf("Reset left no root: %v", err)
+	}
+	v := c.Versions.Get(testGUN)
+	if v == nil || v.Timestamp != before.Timestamp || !v.TimestampAdvanced.After(before.TimestampAdvanced) {
+		t.Errorf("Reset did not forget and record versions again: %+v, was %+v", v, before)
+	}
+}
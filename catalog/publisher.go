@@ -0,0 +1,168 @@
+package catalog
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/docker/notary/trustmanager"
+	"github.com/docker/notary/tuf/data"
+	"github.com/endophage/conman/manifest"
+)
+
+// Publisher is a delegation allowed to sign the targets of some of the
+// catalog's applications.
+type Publisher struct {
+	// Name is the publisher name, the last element of Role.
+	Name string
+	// Role is the delegation role, targets/<name>.
+	Role string
+	// Apps are the apps the publisher may sign. Each also covers the apps
+	// named after it with a "-" suffix, such as spotify-beta for spotify.
+	Apps []string
+	// KeyIDs are the canonical IDs of the publisher's signing keys.
+	KeyIDs    []string
+	Threshold int
+}
+
+// PublisherRole returns the delegation role of the named publisher.
+func PublisherRole(publisher string) (string, error) {
+	role := data.CanonicalTargetsRole + "/" + publisher
+	if publisher == "" || strings.Contains(publisher, "/") || !data.IsDelegation(role) || isChannelRole(role) {
+		return "", fmt.Errorf("invalid publisher name %q", publisher)
+	}
+	return role, nil
+}
+
+// LoadPublisherKey reads a publisher's public key from a PEM encoded
+// certificate, such as one generated by notary key generate.
+func LoadPublisherKey(path string) (data.PublicKey, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := trustmanager.ParsePEMPublicKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return key, nil
+}
+
+// AddPublisher stages the creation of the publisher's delegation, or adds
+// keys and applications to an existing one. Publishers may only sign the
+// given apps, or apps named after them with a "-" suffix. A new delegation
+// with a threshold above one needs that many of its keys to sign, through a
+// Bundle. The changes are pushed by a subsequent NotaryRepository.Publish.
+func (c *Catalog) AddPublisher(publisher string, keys []data.PublicKey, apps []string, threshold int) error {
+	role, err := PublisherRole(publisher)
+	if err != nil {
+		return err
+	}
+	for _, app := range apps {
+		if err := manifest.CheckAppName(app); err != nil {
+			return err
+		}
+	}
+	return c.addDelegation(role, keys, apps, threshold)
+}
+
+// RemovePublisher stages the removal of apps from the publisher's
+// delegation, or of the whole delegation if no apps are given.
+func (c *Catalog) RemovePublisher(publisher string, apps []string) error {
+	role, err := PublisherRole(publisher)
+	if err != nil {
+		return err
+	}
+	if len(apps) == 0 {
+		return c.Repo.RemoveDelegationRole(role)
+	}
+	return c.Repo.RemoveDelegationPaths(role, apps)
+}
+
+// Publishers returns the catalog's publisher delegations, sorted by role.
+// Channel delegations are not publishers.
+func (c *Catalog) Publishers() ([]*Publisher, error) {
+	roles, err := c.Repo.GetDelegationRoles()
+	if err != nil {
+		return nil, err
+	}
+	var pubs []*Publisher
+	for _, r := range roles {
+		if isChannelRole(r.Name) {
+			continue
+		}
+		pubs = append(pubs, &Publisher{
+			Name:      strings.TrimPrefix(r.Name, data.CanonicalTargetsRole+"/"),
+			Role:      r.Name,
+			Apps:      r.Paths,
+			KeyIDs:    r.KeyIDs,
+			Threshold: r.Threshold,
+		})
+	}
+	sort.Sort(byRole(pubs))
+	return pubs, nil
+}
+
+// Publisher returns the delegation for role, or nil if there is none.
+func (c *Catalog) Publisher(role string) (*Publisher, error) {
+	pubs, err := c.Publishers()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range pubs {
+		if p.Role == role {
+			return p, nil
+		}
+	}
+	return nil, nil
+}
+
+// CanSign reports whether the publisher's delegation covers the named
+// application. The delegation's paths are prefixes to TUF, so conman
+// compares whole names itself: a publisher of sky may not sign skype.
+func (p *Publisher) CanSign(app string) bool {
+	return covers(p.Apps, app)
+}
+
+// covers reports whether app is one of apps, or one of them followed by a
+// "-" suffix.
+func covers(apps []string, app string) bool {
+	for _, a := range apps {
+		if app == a || strings.HasPrefix(app, a+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// maySign reports whether the delegation may sign the named app. Channel
+// delegations may sign any app, publishers only those CanSign allows.
+func maySign(d data.DelegationRole, app string) bool {
+	if !d.CheckPaths(app) {
+		return false
+	}
+	return isChannelRole(d.Name) || covers(d.Paths, app)
+}
+
+// checkSigner returns an error if the app was signed by a publisher whose
+// delegation does not cover it, as a publisher of sky signing skype.
+func (c *Catalog) checkSigner(app, role string) error {
+	if role == data.CanonicalTargetsRole || isChannelRole(role) {
+		return nil
+	}
+	d, err := c.delegation(role)
+	if err != nil {
+		return err
+	}
+	if !maySign(d, app) {
+		return fmt.Errorf("%s is signed by %s, which may not sign it", app, role)
+	}
+	return nil
+}
+
+type byRole []*Publisher
+
+func (p byRole) Len() int           { return len(p) }
+func (p byRole) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p byRole) Less(i, j int) bool { return p[i].Role < p[j].Role }
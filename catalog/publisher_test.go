@@ -0,0 +1,46 @@
+package catalog
+
+import (
+	"testing"
+
+	"github.com/docker/notary/tuf/data"
+)
+
+func TestCanSign(t *testing.T) {
+	p := &Publisher{Apps: []string{"sky", "spotify"}}
+	for _, tt := range []struct {
+		app  string
+		want bool
+	}{
+		{"sky", true},
+		{"sky-beta", true},
+		{"spotify", true},
+		{"skype", false},
+		{"sk", false},
+		{"atom", false},
+	} {
+		if got := p.CanSign(tt.app); got != tt.want {
+			t.Errorf("CanSign(%q) = %v, want %v", tt.app, got, tt.want)
+		}
+	}
+}
+
+func TestMaySign(t *testing.T) {
+	for _, tt := range []struct {
+		role  string
+		paths []string
+		app   string
+		want  bool
+	}{
+		{"targets/sky", []string{"sky"}, "sky", true},
+		{"targets/sky", []string{"sky"}, "skype", false},
+		{"targets/sky", []string{"sky"}, "atom", false},
+		{"targets/releases", []string{""}, "skype", true},
+		{"targets/beta", []string{"sky"}, "atom", false},
+	} {
+		d := data.DelegationRole{BaseRole: data.BaseRole{Name: tt.role}, Paths: tt.paths}
+		if got := maySign(d, tt.app); got != tt.want {
+			t.Errorf("%s %v signing %s: got %v, want %v", tt.role, tt.paths, tt.app, got, tt.want)
+		}
+	}
+}
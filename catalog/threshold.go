@@ -0,0 +1,463 @@
+package catalog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	cjson "github.com/docker/go/canonical/json"
+	"github.com/docker/notary/client/changelist"
+	"github.com/docker/notary/tuf/data"
+	"github.com/docker/notary/tuf/signed"
+	"github.com/docker/notary/tuf/store"
+	"github.com/docker/notary/tuf/utils"
+	"github.com/endophage/conman/atomicfile"
+)
+
+// ErrThresholdNotMet is returned when a bundle is pushed with fewer valid
+// signatures than its role's threshold.
+type ErrThresholdNotMet struct {
+	Role string
+	Have int
+	Need int
+}
+
+func (err ErrThresholdNotMet) Error() string {
+	return fmt.Sprintf("%s needs %d signatures, the bundle has %d", err.Role, err.Need, err.Have)
+}
+
+// Bundle is the staged targets metadata of a delegation that needs more
+// than one signature. It is passed between the delegation's signers, each
+// adding a signature, and pushed once the threshold is met.
+type Bundle struct {
+	GUN      string       `json:"gun"`
+	Role     string       `json:"role"`
+	Metadata *data.Signed `json:"metadata"`
+}
+
+// LoadBundle reads a bundle written by Bundle.Save.
+func LoadBundle(path string) (*Bundle, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	bundle := &Bundle{}
+	if err := json.Unmarshal(b, bundle); err != nil {
+		return nil, fmt.Errorf("parsing bundle %s: %v", path, err)
+	}
+	if bundle.GUN == "" || !data.IsDelegation(bundle.Role) || bundle.Metadata == nil {
+		return nil, fmt.Errorf("%s is not a signing bundle", path)
+	}
+	// signatures are over the canonical form of the metadata, which the
+	// indented file does not keep
+	var decoded interface{}
+	if err := cjson.Unmarshal(bundle.Metadata.Signed, &decoded); err != nil {
+		return nil, fmt.Errorf("parsing bundle %s: %v", path, err)
+	}
+	if bundle.Metadata.Signed, err = cjson.MarshalCanonical(decoded); err != nil {
+		return nil, err
+	}
+	return bundle, nil
+}
+
+// Save atomically writes the bundle to path.
+func (b *Bundle) Save(path string) error {
+	out, err := json.MarshalIndent(b, "", "\t")
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(path, append(out, '\n'), 0644)
+}
+
+// Targets returns the bundle's targets metadata.
+func (b *Bundle) Targets() (*data.SignedTargets, error) {
+	return data.TargetsFromSigned(b.Metadata, b.Role)
+}
+
+// TargetChange is a difference between a bundle's targets and the
+// published targets of its role.
+type TargetChange struct {
+	Name string
+	// Old is the published target, nil for a target the bundle adds.
+	Old *data.FileMeta
+	// New is the bundle's target, nil for a target the bundle removes.
+	New *data.FileMeta
+}
+
+func (c TargetChange) String() string {
+	switch {
+	case c.Old == nil:
+		return fmt.Sprintf("+ %s (sha256:%x, %d bytes)", c.Name, c.New.Hashes["sha256"], c.New.Length)
+	case c.New == nil:
+		return fmt.Sprintf("- %s", c.Name)
+	}
+	return fmt.Sprintf("~ %s (sha256:%x -> sha256:%x)", c.Name, c.Old.Hashes["sha256"], c.New.Hashes["sha256"])
+}
+
+// delegationRole returns the catalog's delegation role, or nil if there is
+// none.
+func (c *Catalog) delegationRole(role string) (*data.Role, error) {
+	roles, err := c.Repo.GetDelegationRoles()
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range roles {
+		if r.Name == role {
+			return r, nil
+		}
+	}
+	return nil, nil
+}
+
+// RoleThreshold returns the number of signatures the delegation role needs,
+// or 0 if the catalog has no such role.
+func (c *Catalog) RoleThreshold(role string) (int, error) {
+	r, err := c.delegationRole(role)
+	if err != nil || r == nil {
+		return 0, err
+	}
+	return r.Threshold, nil
+}
+
+// addDelegation stages the creation of role, or adds keys and paths to an
+// existing one. With a threshold above one, the role's targets are only
+// valid signed by that many of its keys. The notary client only creates
+// delegations with a threshold of one and never changes the threshold of
+// an existing one, so neither can conman.
+func (c *Catalog) addDelegation(role string, keys []data.PublicKey, paths []string, threshold int) error {
+	if threshold <= 1 {
+		return c.Repo.AddDelegation(role, keys, paths)
+	}
+	existing, err := c.RoleThreshold(role)
+	if err != nil {
+		return err
+	}
+	if existing > 0 {
+		return fmt.Errorf("%s already exists with a threshold of %d, remove it and add it again to change the threshold", role, existing)
+	}
+	if len(keys) < threshold {
+		return fmt.Errorf("a threshold of %d needs at least %d keys, only %d given", threshold, threshold, len(keys))
+	}
+	td, err := json.Marshal(&changelist.TufDelegation{
+		NewThreshold: threshold,
+		AddKeys:      data.KeyList(keys),
+		AddPaths:     paths,
+	})
+	if err != nil {
+		return err
+	}
+	cl, err := changelist.NewFileChangelist(filepath.Join(c.TrustDir, "tuf", filepath.FromSlash(c.GUN), "changelist"))
+	if err != nil {
+		return err
+	}
+	defer cl.Close()
+	return cl.Add(changelist.NewTufChange(changelist.ActionCreate, role, changelist.TypeTargetsDelegation, "", td))
+}
+
+// cachedTargets returns the cached targets metadata of role, or nil if none
+// is cached. The metadata is not verified.
+func (c *Catalog) cachedTargets(role string) (*data.SignedTargets, error) {
+	b, err := ioutil.ReadFile(filepath.Join(c.metadataDir(), filepath.FromSlash(role)+".json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s := &data.Signed{}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("cached %s metadata for %s is corrupt: %v", role, c.GUN, err)
+	}
+	return data.TargetsFromSigned(s, role)
+}
+
+// delegation returns the keys, threshold and paths of the delegation role
+// as the cached base targets metadata delegates it.
+func (c *Catalog) delegation(role string) (data.DelegationRole, error) {
+	base, err := c.cachedTargets(data.CanonicalTargetsRole)
+	if err != nil {
+		return data.DelegationRole{}, err
+	}
+	if base == nil {
+		return data.DelegationRole{}, ErrNotCached{GUN: c.GUN}
+	}
+	return base.BuildDelegationRole(role)
+}
+
+// refresh updates the cached trust data, or checks it is usable offline,
+// and checks it as for Lookup.
+func (c *Catalog) refresh() error {
+	if _, err := c.Repo.Update(false); err != nil {
+		return c.explainOffline(err)
+	}
+	return c.checkUpdate()
+}
+
+// StageBundle returns an unsigned bundle of the delegation role's published
+// targets with files added or replaced, as the role's next version.
+func (c *Catalog) StageBundle(role string, files data.Files) (*Bundle, error) {
+	if err := c.refresh(); err != nil {
+		return nil, err
+	}
+	delegation, err := c.delegation(role)
+	if err != nil {
+		return nil, err
+	}
+	t, err := c.cachedTargets(role)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		t = data.NewTargets()
+	}
+	for name, meta := range files {
+		if !maySign(delegation, name) {
+			return nil, fmt.Errorf("%s may not sign %s", role, name)
+		}
+		t.Signed.Targets[name] = meta
+	}
+	t.Signed.Version++
+	t.Signed.Expires = data.DefaultExpires(data.CanonicalTargetsRole)
+	t.Signatures = nil
+	s, err := t.ToSigned()
+	if err != nil {
+		return nil, err
+	}
+	return &Bundle{GUN: c.GUN, Role: role, Metadata: s}, nil
+}
+
+// checkBundle checks that the bundle is the next version of its role's
+// cached targets for the catalog, and only signs targets the role may.
+func (c *Catalog) checkBundle(b *Bundle) (*data.SignedTargets, data.DelegationRole, error) {
+	if b.GUN != c.GUN {
+		return nil, data.DelegationRole{}, fmt.Errorf("the bundle is for %s, not %s", b.GUN, c.GUN)
+	}
+	delegation, err := c.delegation(b.Role)
+	if err != nil {
+		return nil, delegation, err
+	}
+	t, err := b.Targets()
+	if err != nil {
+		return nil, delegation, err
+	}
+	cur, err := c.cachedTargets(b.Role)
+	if err != nil {
+		return nil, delegation, err
+	}
+	published := 0
+	if cur != nil {
+		published = cur.Signed.Version
+	}
+	if t.Signed.Version != published+1 {
+		return nil, delegation, fmt.Errorf("the bundle is version %d of %s but version %d is published, the changes must be staged again", t.Signed.Version, b.Role, published)
+	}
+	for name := range t.Signed.Targets {
+		if !maySign(delegation, name) {
+			return nil, delegation, fmt.Errorf("%s may not sign %s", b.Role, name)
+		}
+	}
+	if len(t.Signed.Delegations.Roles) > 0 {
+		return nil, delegation, fmt.Errorf("the bundle delegates from %s, which conman does not publish", b.Role)
+	}
+	return t, delegation, nil
+}
+
+// CheckBundle refreshes the trust data, checks that the bundle still
+// applies to its role's published targets, and returns the changes it
+// makes to them, sorted by name.
+func (c *Catalog) CheckBundle(b *Bundle) ([]TargetChange, error) {
+	if err := c.refresh(); err != nil {
+		return nil, err
+	}
+	t, _, err := c.checkBundle(b)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := c.cachedTargets(b.Role)
+	if err != nil {
+		return nil, err
+	}
+	if cur == nil {
+		cur = data.NewTargets()
+	}
+	var changes []TargetChange
+	for name, meta := range t.Signed.Targets {
+		meta := meta
+		old, ok := cur.Signed.Targets[name]
+		if !ok {
+			changes = append(changes, TargetChange{Name: name, New: &meta})
+		} else if !sameMeta(old, meta) {
+			changes = append(changes, TargetChange{Name: name, Old: &old, New: &meta})
+		}
+	}
+	for name, meta := range cur.Signed.Targets {
+		meta := meta
+		if _, ok := t.Signed.Targets[name]; !ok {
+			changes = append(changes, TargetChange{Name: name, Old: &meta})
+		}
+	}
+	sort.Sort(byChangeName(changes))
+	return changes, nil
+}
+
+func sameMeta(a, b data.FileMeta) bool {
+	if a.Length != b.Length || len(a.Hashes) != len(b.Hashes) || !bytes.Equal(a.Custom, b.Custom) {
+		return false
+	}
+	for alg, h := range a.Hashes {
+		if !bytes.Equal(h, b.Hashes[alg]) {
+			return false
+		}
+	}
+	return true
+}
+
+// SignBundle adds signatures to the bundle with every key of its role held
+// locally, after checking it as for CheckBundle against the cached trust
+// data.
+func (c *Catalog) SignBundle(b *Bundle) error {
+	_, delegation, err := c.checkBundle(b)
+	if err != nil {
+		return err
+	}
+	err = signed.Sign(c.Repo.CryptoService, b.Metadata, delegation.ListKeys()...)
+	if _, ok := err.(signed.ErrNoKeys); ok {
+		return fmt.Errorf("none of the keys of %s are held locally", b.Role)
+	}
+	return err
+}
+
+// BundleSignatures returns the canonical IDs of the role keys that validly
+// signed the bundle, and the number of signatures its role needs.
+func (c *Catalog) BundleSignatures(b *Bundle) ([]string, int, error) {
+	delegation, err := c.delegation(b.Role)
+	if err != nil {
+		return nil, 0, err
+	}
+	// verify each signature on its own to count the valid ones
+	one := delegation.BaseRole
+	one.Threshold = 1
+	seen := make(map[string]bool)
+	var ids []string
+	for _, sig := range b.Metadata.Signatures {
+		s := &data.Signed{Signed: b.Metadata.Signed, Signatures: []data.Signature{sig}}
+		if seen[sig.KeyID] || signed.VerifySignatures(s, one) != nil {
+			continue
+		}
+		seen[sig.KeyID] = true
+		id, err := utils.CanonicalKeyID(delegation.Keys[sig.KeyID])
+		if err != nil {
+			return nil, 0, err
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, delegation.Threshold, nil
+}
+
+// PushBundle refreshes the trust data and, if the bundle still applies and
+// has as many valid signatures as its role needs, uploads it to the notary
+// server. The snapshot is signed too if its key is held locally, and is
+// otherwise left to the server.
+func (c *Catalog) PushBundle(b *Bundle) error {
+	if c.Offline {
+		return errors.New("bundles cannot be pushed offline")
+	}
+	if err := c.refresh(); err != nil {
+		return err
+	}
+	t, delegation, err := c.checkBundle(b)
+	if err != nil {
+		return err
+	}
+	ids, need, err := c.BundleSignatures(b)
+	if err != nil {
+		return err
+	}
+	if len(ids) < need {
+		return ErrThresholdNotMet{Role: b.Role, Have: len(ids), Need: need}
+	}
+	if err := signed.Verify(b.Metadata, delegation.BaseRole, t.Signed.Version); err != nil {
+		return fmt.Errorf("verifying bundle for %s: %v", b.Role, err)
+	}
+
+	meta, err := json.Marshal(b.Metadata)
+	if err != nil {
+		return err
+	}
+	files := map[string][]byte{b.Role: meta}
+	snapshot, err := c.signSnapshot(b.Role, meta)
+	if err != nil {
+		return err
+	}
+	if snapshot != nil {
+		files[data.CanonicalSnapshotRole] = snapshot
+	}
+	remote, err := store.NewHTTPStore(c.server+"/v2/"+c.GUN+"/_trust/tuf/", "", "json", "key", c.rt)
+	if err != nil {
+		return err
+	}
+	if err := remote.SetMultiMeta(files); err != nil {
+		return err
+	}
+	return c.refresh()
+}
+
+// signSnapshot returns the cached snapshot recording meta as the new
+// metadata of role, signed, or nil if the snapshot key is not held locally.
+func (c *Catalog) signSnapshot(role string, meta []byte) ([]byte, error) {
+	root, err := c.cachedRoot()
+	if err != nil || root == nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(filepath.Join(c.metadataDir(), data.CanonicalSnapshotRole+".json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s := &data.Signed{}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("cached snapshot for %s is corrupt: %v", c.GUN, err)
+	}
+	snap, err := data.SnapshotFromSigned(s)
+	if err != nil {
+		return nil, err
+	}
+	snapshotRole, err := root.BuildBaseRole(data.CanonicalSnapshotRole)
+	if err != nil {
+		return nil, err
+	}
+	fm, err := data.NewFileMeta(bytes.NewReader(meta), "sha256")
+	if err != nil {
+		return nil, err
+	}
+	snap.AddMeta(role, fm)
+	snap.Signed.Version++
+	snap.Signed.Expires = data.DefaultExpires(data.CanonicalSnapshotRole)
+	snap.Signatures = nil
+	s, err = snap.ToSigned()
+	if err != nil {
+		return nil, err
+	}
+	err = signed.Sign(c.Repo.CryptoService, s, snapshotRole.ListKeys()...)
+	if _, ok := err.(signed.ErrNoKeys); ok {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(s)
+}
+
+type byChangeName []TargetChange
+
+func (c byChangeName) Len() int           { return len(c) }
+func (c byChangeName) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c byChangeName) Less(i, j int) bool { return c[i].Name < c[j].Name }
@@ -0,0 +1,226 @@
+package catalog
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/docker/notary/tuf/data"
+)
+
+const testRole = "targets/atom"
+
+// testSigners opens n catalogs of the test server, each holding one key,
+// and delegates testRole to their keys with the given threshold.
+func testSigners(t *testing.T, s *testServer, n, threshold int) ([]*Catalog, []string) {
+	var (
+		signers []*Catalog
+		keys    data.KeyList
+		ids     []string
+	)
+	for i := 0; i < n; i++ {
+		c := testCatalog(t, s)
+		key, err := c.Repo.CryptoService.Create(testRole, data.ECDSAKey)
+		if err != nil {
+			os.RemoveAll(c.TrustDir)
+			t.Fatal(err)
+		}
+		signers = append(signers, c)
+		keys = append(keys, key)
+		ids = append(ids, key.ID())
+	}
+	s.addDelegation(testRole, keys, threshold, "atom")
+	s.publish()
+	return signers, ids
+}
+
+func removeSigners(signers []*Catalog) {
+	for _, c := range signers {
+		os.RemoveAll(c.TrustDir)
+	}
+}
+
+func sorted(ids ...string) []string {
+	ids = append([]string(nil), ids...)
+	sort.Strings(ids)
+	return ids
+}
+
+func TestBundleSignatures(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	signers, keys := testSigners(t, s, 3, 2)
+	defer removeSigners(signers)
+	a, b := signers[0], signers[1]
+
+	bundle, err := a.StageBundle(testRole, data.Files{"atom": testMeta(t, "atom"), "atom-beta": testMeta(t, "atom-beta")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := func(c *Catalog, bundle *Bundle, want []string) {
+		ids, need, err := c.BundleSignatures(bundle)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if need != 2 || len(ids) != len(want) || len(ids) > 0 && !reflect.DeepEqual(ids, want) {
+			t.Errorf("bundle signed by %v, needing %d; want %v, needing 2", ids, need, want)
+		}
+	}
+	count(a, bundle, nil)
+	if err := a.PushBundle(bundle); err != (ErrThresholdNotMet{Role: testRole, Have: 0, Need: 2}) {
+		t.Errorf("pushing an unsigned bundle = %v", err)
+	}
+
+	if err := a.SignBundle(bundle); err != nil {
+		t.Fatal(err)
+	}
+	count(a, bundle, keys[:1])
+	if err := a.PushBundle(bundle); err != (ErrThresholdNotMet{Role: testRole, Have: 1, Need: 2}) {
+		t.Errorf("pushing a bundle with one of two signatures = %v", err)
+	}
+
+	// neither a repeated signature nor one by a key that did not make it
+	// counts
+	sig := bundle.Metadata.Signatures[0]
+	forged := sig
+	forged.KeyID = keys[2]
+	unknown := sig
+	unknown.KeyID = "0123"
+	replayed := &Bundle{GUN: bundle.GUN, Role: bundle.Role, Metadata: &data.Signed{
+		Signed:     bundle.Metadata.Signed,
+		Signatures: []data.Signature{sig, sig, forged, unknown},
+	}}
+	count(a, replayed, keys[:1])
+	if err := a.PushBundle(replayed); err != (ErrThresholdNotMet{Role: testRole, Have: 1, Need: 2}) {
+		t.Errorf("pushing a bundle with one valid signature = %v", err)
+	}
+
+	// the bundle is passed to the next signer as a file
+	path := filepath.Join(a.TrustDir, "atom.bundle")
+	if err := bundle.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadBundle(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.CheckBundle(loaded); err != nil {
+		t.Fatal(err)
+	}
+	count(b, loaded, keys[:1])
+	if err := b.SignBundle(loaded); err != nil {
+		t.Fatal(err)
+	}
+	count(b, loaded, sorted(keys[:2]...))
+
+	if err := b.PushBundle(loaded); err != nil {
+		t.Fatalf("pushing a bundle meeting the threshold = %v", err)
+	}
+	app, err := signers[2].Lookup("atom-beta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if app.Role != testRole {
+		t.Errorf("pushed app is signed by %s, want %s", app.Role, testRole)
+	}
+	if _, err := a.CheckBundle(loaded); err == nil || !strings.Contains(err.Error(), "staged again") {
+		t.Errorf("checking a bundle that was already pushed = %v", err)
+	}
+}
+
+// rebundle returns a copy of the bundle with its targets changed by f.
+func rebundle(t *testing.T, b *Bundle, f func(*data.SignedTargets)) *Bundle {
+	tgts, err := b.Targets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f(tgts)
+	s, err := tgts.ToSigned()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Bundle{GUN: b.GUN, Role: b.Role, Metadata: s}
+}
+
+func TestCheckBundle(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	signers, _ := testSigners(t, s, 2, 2)
+	defer removeSigners(signers)
+	c := signers[0]
+
+	if _, err := c.StageBundle(testRole, data.Files{"gimp": testMeta(t, "gimp")}); err == nil || !strings.Contains(err.Error(), "may not sign gimp") {
+		t.Errorf("staging an app the role may not sign = %v", err)
+	}
+	staged, err := c.StageBundle(testRole, data.Files{"atom": testMeta(t, "atom")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherGUN := *staged
+	otherGUN.GUN = "docker.io/other/apps"
+	subKey, err := c.Repo.CryptoService.Create(testRole+"/more", data.ECDSAKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := data.NewRole(testRole+"/more", 1, []string{subKey.ID()}, []string{"atom"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		bundle *Bundle
+		err    string
+	}{
+		{name: "staged", bundle: staged},
+		{name: "other catalog", bundle: &otherGUN, err: "for docker.io/other/apps"},
+		{
+			name: "skipped version",
+			bundle: rebundle(t, staged, func(tgts *data.SignedTargets) {
+				tgts.Signed.Version++
+			}),
+			err: "version 2 of targets/atom but version 0 is published",
+		},
+		{
+			name: "other app",
+			bundle: rebundle(t, staged, func(tgts *data.SignedTargets) {
+				tgts.Signed.Targets["gimp"] = testMeta(t, "gimp")
+			}),
+			err: "may not sign gimp",
+		},
+		{
+			name: "sharing a prefix",
+			bundle: rebundle(t, staged, func(tgts *data.SignedTargets) {
+				tgts.Signed.Targets["atomic"] = testMeta(t, "atomic")
+			}),
+			err: "may not sign atomic",
+		},
+		{
+			name: "delegating",
+			bundle: rebundle(t, staged, func(tgts *data.SignedTargets) {
+				tgts.Signed.Delegations.Keys = data.Keys{subKey.ID(): subKey}
+				tgts.Signed.Delegations.Roles = []*data.Role{sub}
+			}),
+			err: "delegates from",
+		},
+	} {
+		changes, err := c.CheckBundle(tt.bundle)
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("%s: CheckBundle = %v", tt.name, err)
+			} else if len(changes) != 1 || changes[0].Name != "atom" || changes[0].Old != nil {
+				t.Errorf("%s: CheckBundle changes = %v", tt.name, changes)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: CheckBundle = %v, want an error containing %q", tt.name, err, tt.err)
+		}
+		if err := c.SignBundle(tt.bundle); err == nil {
+			t.Errorf("%s: SignBundle signed it", tt.name)
+		}
+	}
+}
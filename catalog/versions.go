@@ -0,0 +1,183 @@
+package catalog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/notary/tuf/data"
+	"github.com/endophage/conman/atomicfile"
+)
+
+// Versions are the highest metadata versions ever verified for a catalog.
+type Versions struct {
+	Timestamp int `json:"timestamp"`
+	Snapshot  int `json:"snapshot"`
+	Targets   int `json:"targets"`
+	// TimestampAdvanced is when the timestamp version last increased.
+	TimestampAdvanced time.Time `json:"timestamp_advanced"`
+}
+
+// VersionLog records the highest metadata versions verified for each
+// catalog, persisted as a JSON file. It is kept apart from the notary
+// cache so deleting trust data does not reset it.
+type VersionLog struct {
+	path string
+	guns map[string]*Versions
+}
+
+// OpenVersionLog loads the version log at path. A missing file is an empty
+// log.
+func OpenVersionLog(path string) (*VersionLog, error) {
+	l := &VersionLog{path: path, guns: make(map[string]*Versions)}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &l.guns); err != nil {
+		return nil, fmt.Errorf("parsing version log %s: %v", path, err)
+	}
+	return l, nil
+}
+
+// Get returns the versions recorded for gun, or nil if there are none.
+func (l *VersionLog) Get(gun string) *Versions {
+	return l.guns[gun]
+}
+
+// Forget drops the versions recorded for gun, so any version is accepted
+// on the next update.
+func (l *VersionLog) Forget(gun string) {
+	delete(l.guns, gun)
+}
+
+// Save atomically writes the log back to disk.
+func (l *VersionLog) Save() error {
+	b, err := json.MarshalIndent(l.guns, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0700); err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(l.path, append(b, '\n'), 0600)
+}
+
+// ErrRollback is returned when the catalog's metadata is older than
+// metadata verified before, as when an old catalog is replayed.
+type ErrRollback struct {
+	GUN     string
+	Role    string
+	Version int
+	Highest int
+}
+
+func (err ErrRollback) Error() string {
+	return fmt.Sprintf("%s metadata for %s is version %d, older than version %d seen before: the catalog may have been rolled back", err.Role, err.GUN, err.Version, err.Highest)
+}
+
+// ErrFrozen reports a timestamp that has not advanced for longer than the
+// staleness window, as when a server keeps serving an old catalog.
+type ErrFrozen struct {
+	GUN     string
+	Version int
+	Since   time.Time
+}
+
+func (err ErrFrozen) Error() string {
+	return fmt.Sprintf("the timestamp for %s has been at version %d since %s: the catalog may be frozen", err.GUN, err.Version, err.Since.Local().Format("2006-01-02 15:04"))
+}
+
+// CheckVersions returns ErrRollback if the cached timestamp, snapshot or
+// targets metadata is older than the highest version recorded in the
+// catalog's version log, and otherwise records any newer versions as
+// verified at t.
+func (c *Catalog) CheckVersions(t time.Time) error {
+	if c.Versions == nil {
+		return nil
+	}
+	roles, err := c.CachedRoles()
+	if err != nil {
+		return err
+	}
+	cur := make(map[string]int)
+	for _, r := range roles {
+		cur[r.Role] = r.Version
+	}
+	if len(cur) == 0 {
+		return nil
+	}
+
+	v := c.Versions.Get(c.GUN)
+	if v == nil {
+		v = &Versions{}
+	}
+	updated := *v
+	for _, f := range []struct {
+		role    string
+		highest *int
+	}{
+		{data.CanonicalTimestampRole, &updated.Timestamp},
+		{data.CanonicalSnapshotRole, &updated.Snapshot},
+		{data.CanonicalTargetsRole, &updated.Targets},
+	} {
+		version, ok := cur[f.role]
+		if !ok {
+			continue
+		}
+		if version < *f.highest {
+			return ErrRollback{GUN: c.GUN, Role: f.role, Version: version, Highest: *f.highest}
+		}
+		*f.highest = version
+	}
+	if updated.Timestamp > v.Timestamp {
+		updated.TimestampAdvanced = t
+	}
+	if updated == *v {
+		return nil
+	}
+	c.Versions.guns[c.GUN] = &updated
+	return c.Versions.Save()
+}
+
+// Frozen returns ErrFrozen if the catalog's timestamp has not advanced for
+// longer than the catalog's Staleness at t. It never does with no
+// Staleness.
+func (c *Catalog) Frozen(t time.Time) error {
+	if c.Versions == nil || c.Staleness <= 0 {
+		return nil
+	}
+	v := c.Versions.Get(c.GUN)
+	if v == nil || v.TimestampAdvanced.IsZero() {
+		return nil
+	}
+	if t.Sub(v.TimestampAdvanced) > c.Staleness {
+		return ErrFrozen{GUN: c.GUN, Version: v.Timestamp, Since: v.TimestampAdvanced}
+	}
+	return nil
+}
+
+// checkUpdate checks the trust data after the notary client updated it:
+// the root against the pin and the versions against the version log. A
+// frozen timestamp is only warned about, as the metadata is still valid,
+// and only online, where the timestamp could have advanced.
+func (c *Catalog) checkUpdate() error {
+	if err := c.checkPin(true); err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := c.CheckVersions(now); err != nil {
+		return err
+	}
+	if err := c.Frozen(now); err != nil && !c.Offline {
+		logrus.Warn(err)
+	}
+	return nil
+}
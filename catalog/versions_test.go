@@ -0,0 +1,155 @@
+package catalog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/notary/tuf/data"
+)
+
+// versionedCatalog opens the test server's catalog with a version log in
+// its trust directory.
+func versionedCatalog(t *testing.T, s *testServer) *Catalog {
+	c := testCatalog(t, s)
+	var err error
+	if c.Versions, err = OpenVersionLog(filepath.Join(c.TrustDir, "versions.json")); err != nil {
+		os.RemoveAll(c.TrustDir)
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestVersionLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "versions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "conman", "versions.json")
+
+	l, err := OpenVersionLog(path)
+	if err != nil {
+		t.Fatalf("opening a missing log: %v", err)
+	}
+	if v := l.Get(testGUN); v != nil {
+		t.Errorf("empty log has versions %+v", v)
+	}
+	want := &Versions{Timestamp: 3, Snapshot: 2, Targets: 2, TimestampAdvanced: time.Date(2016, 5, 1, 12, 0, 0, 0, time.UTC)}
+	l.guns[testGUN] = want
+	l.guns["docker.io/other"] = &Versions{Timestamp: 1}
+	if err := l.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err = OpenVersionLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := l.Get(testGUN); !reflect.DeepEqual(v, want) {
+		t.Errorf("reloaded versions %+v, want %+v", v, want)
+	}
+	l.Forget(testGUN)
+	if v := l.Get(testGUN); v != nil {
+		t.Errorf("forgotten versions are %+v", v)
+	}
+	if v := l.Get("docker.io/other"); v == nil {
+		t.Error("forgetting one catalog forgot another")
+	}
+}
+
+func TestCheckVersions(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	s.addTarget(data.CanonicalTargetsRole, "atom")
+	s.publish()
+	old := s.meta
+	s.publish()
+
+	c := versionedCatalog(t, s)
+	defer os.RemoveAll(c.TrustDir)
+	if _, err := c.Lookup("atom"); err != nil {
+		t.Fatal(err)
+	}
+	seen := *c.Versions.Get(testGUN)
+	if seen.Timestamp == 0 || seen.Snapshot == 0 || seen.Targets == 0 || seen.TimestampAdvanced.IsZero() {
+		t.Fatalf("versions not recorded: %+v", seen)
+	}
+	// an unchanged catalog records nothing new
+	if err := c.CheckVersions(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if v := *c.Versions.Get(testGUN); v != seen {
+		t.Errorf("versions changed without an update: %+v, was %+v", v, seen)
+	}
+
+	// the notary client refuses to replace its cache with the older
+	// catalog; once the cache is gone, the version log still refuses it
+	s.meta = old
+	if err := c.Repo.DeleteTrustData(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Lookup("atom"); !isRollback(err, data.CanonicalTimestampRole, seen.Timestamp) {
+		t.Errorf("Lookup of a replayed catalog = %v", err)
+	}
+	if err := c.Reset(false); !isRollback(err, data.CanonicalTimestampRole, seen.Timestamp) {
+		t.Errorf("Reset to a replayed catalog = %v", err)
+	}
+	if root, err := c.cachedRoot(); err != nil || root != nil {
+		t.Errorf("Reset kept the replayed metadata: %v", err)
+	}
+	if v := *c.Versions.Get(testGUN); v != seen {
+		t.Errorf("rollback changed the versions: %+v, was %+v", v, seen)
+	}
+
+	// unless the versions are forgotten
+	if err := c.Reset(true); err != nil {
+		t.Fatalf("Reset forgetting versions = %v", err)
+	}
+	if v := c.Versions.Get(testGUN); v == nil || v.Timestamp >= seen.Timestamp {
+		t.Errorf("versions after reset are %+v, want older than %+v", v, seen)
+	}
+}
+
+func isRollback(err error, role string, highest int) bool {
+	r, ok := err.(ErrRollback)
+	return ok && r.GUN == testGUN && r.Role == role && r.Highest == highest && r.Version < highest
+}
+
+func TestFrozen(t *testing.T) {
+	now := time.Now()
+	for _, tt := range []struct {
+		name      string
+		staleness time.Duration
+		versions  *Versions
+		frozen    bool
+	}{
+		{name: "no staleness", versions: &Versions{Timestamp: 4, TimestampAdvanced: now.Add(-30 * 24 * time.Hour)}},
+		{name: "no versions", staleness: time.Hour},
+		{name: "never advanced", staleness: time.Hour, versions: &Versions{Timestamp: 4}},
+		{name: "fresh", staleness: time.Hour, versions: &Versions{Timestamp: 4, TimestampAdvanced: now.Add(-time.Minute)}},
+		{name: "stale", staleness: time.Hour, versions: &Versions{Timestamp: 4, TimestampAdvanced: now.Add(-2 * time.Hour)}, frozen: true},
+	} {
+		c := &Catalog{GUN: testGUN, Staleness: tt.staleness, Versions: &VersionLog{guns: make(map[string]*Versions)}}
+		if tt.versions != nil {
+			c.Versions.guns[testGUN] = tt.versions
+		}
+		err := c.Frozen(now)
+		if !tt.frozen {
+			if err != nil {
+				t.Errorf("%s: Frozen = %v", tt.name, err)
+			}
+			continue
+		}
+		want := ErrFrozen{GUN: testGUN, Version: tt.versions.Timestamp, Since: tt.versions.TimestampAdvanced}
+		if err != want {
+			t.Errorf("%s: Frozen = %v, want %v", tt.name, err, want)
+		}
+	}
+	if err := (&Catalog{GUN: testGUN, Staleness: time.Hour}).Frozen(now); err != nil {
+		t.Errorf("Frozen without a version log = %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/docker/docker/pkg/term"
+	"github.com/endophage/conman/catalog"
+	"github.com/endophage/conman/manifest"
+	"github.com/endophage/conman/permission"
+)
+
+var cmdBundle = &command{
+	name:  "bundle",
+	args:  "show <bundle.json> | sign <bundle.json> | push <bundle.json>",
+	short: "Review, sign and push changes staged for a delegation's signers",
+	flags: bundleFlags,
+	run:   runBundle,
+}
+
+var bundleOpts struct {
+	yes bool
+}
+
+func bundleFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&bundleOpts.yes, "yes", false, "sign without asking for confirmation")
+}
+
+func runBundle(cfg *config, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	sub, file := args[0], args[1]
+	if sub != "show" && sub != "sign" && sub != "push" {
+		return errUsage
+	}
+	if sub == "push" && cfg.Offline {
+		return errors.New("bundle push cannot be used offline")
+	}
+	bundle, err := catalog.LoadBundle(file)
+	if err != nil {
+		return err
+	}
+	cat, err := cfg.openCatalog()
+	if err != nil {
+		return err
+	}
+	switch sub {
+	case "show":
+		if err := showBundle(cat, bundle); err != nil {
+			return err
+		}
+		return printSignatures(cat, bundle)
+	case "sign":
+		return signBundle(cat, bundle, file)
+	}
+	if err := cat.PushBundle(bundle); err != nil {
+		return err
+	}
+	fmt.Printf("Published %s from %s to %s\n", bundle.Role, file, cat.GUN)
+	return nil
+}
+
+// showBundle prints the changes the bundle makes to its role's published
+// targets, with the image of every app it adds or changes and the access
+// to the host it requests, which are what its signers vouch for.
+func showBundle(cat *catalog.Catalog, bundle *catalog.Bundle) error {
+	changes, err := cat.CheckBundle(bundle)
+	if err != nil {
+		return err
+	}
+	host, err := manifest.CurrentHost()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Bundle for %s in %s\n", bundle.Role, bundle.GUN)
+	if len(changes) == 0 {
+		fmt.Println("No changes.")
+	}
+	for _, c := range changes {
+		fmt.Println(c)
+		if c.New == nil {
+			continue
+		}
+		m, err := manifest.FromCustom(c.New.Custom)
+		if err != nil {
+			fmt.Printf("    invalid manifest: %v\n", err)
+			continue
+		}
+		fmt.Printf("    image %s\n", catalog.ImageFor(c.Name, m))
+		if m.Run == nil {
+			fmt.Printf("    exec %s\n", m.DesktopValue("Exec"))
+		}
+		perms, err := permission.Review(m, host)
+		if err != nil {
+			fmt.Printf("    invalid invocation: %v\n", err)
+			continue
+		}
+		for _, p := range perms {
+			fmt.Printf("    %s\n", p)
+		}
+	}
+	return nil
+}
+
+func printSignatures(cat *catalog.Catalog, bundle *catalog.Bundle) error {
+	ids, need, err := cat.BundleSignatures(bundle)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Signatures: %d of %d", len(ids), need)
+	if len(ids) > 0 {
+		fmt.Printf(" (%s)", strings.Join(ids, ", "))
+	}
+	fmt.Println()
+	return nil
+}
+
+// signBundle shows the bundle's changes and, once confirmed, adds the
+// signatures of the role keys held locally and writes the bundle back.
+func signBundle(cat *catalog.Catalog, bundle *catalog.Bundle, file string) error {
+	if err := showBundle(cat, bundle); err != nil {
+		return err
+	}
+	if !bundleOpts.yes {
+		if !term.IsTerminal(os.Stdin.Fd()) {
+			return errors.New("bundle sign needs confirmation, use -yes to sign without asking")
+		}
+		if !ask(fmt.Sprintf("Sign these changes as %s?", bundle.Role)) {
+			return errors.New("bundle sign cancelled")
+		}
+	}
+	if err := cat.SignBundle(bundle); err != nil {
+		return err
+	}
+	if err := bundle.Save(file); err != nil {
+		return err
+	}
+	return printSignatures(cat, bundle)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/docker/notary/tuf/data"
+	"github.com/endophage/conman/catalog"
+)
+
+var cmdChannel = &command{
+	name:   "channel",
+	args:   "list | [-threshold N] add <channel> <cert.pem>[,<cert.pem>...] | remove <channel>",
+	short:  "Manage the delegations signing the release channels",
+	flags:  delegationFlags,
+	run:    runChannel,
+	online: true,
+}
+
+func runChannel(cfg *config, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	cat, err := cfg.openCatalog()
+	if err != nil {
+		return err
+	}
+	switch sub, args := args[0], args[1:]; {
+	case sub == "list" && len(args) == 0:
+		return listChannels(cat)
+	case sub == "add" && len(args) == 2:
+		keys, err := loadKeys(args[1])
+		if err != nil {
+			return err
+		}
+		if err := cat.AddChannel(args[0], keys, delegationOpts.threshold); err != nil {
+			return err
+		}
+		if err := cat.Repo.Publish(); err != nil {
+			return err
+		}
+		fmt.Printf("Channel %s may now be signed with %s\n", args[0], describeKeys(keys, delegationOpts.threshold))
+	case sub == "remove" && len(args) == 1:
+		if err := cat.RemoveChannel(args[0]); err != nil {
+			return err
+		}
+		if err := cat.Repo.Publish(); err != nil {
+			return err
+		}
+		fmt.Printf("Removed channel %s\n", args[0])
+	default:
+		return errUsage
+	}
+	return nil
+}
+
+func listChannels(cat *catalog.Catalog) error {
+	roles, err := cat.Repo.GetDelegationRoles()
+	if err != nil {
+		return err
+	}
+	delegations := make(map[string]*data.Role)
+	for _, r := range roles {
+		delegations[r.Name] = r
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CHANNEL\tROLE\tTHRESHOLD\tKEYS")
+	for _, ch := range catalog.Channels {
+		role, _ := catalog.ChannelRole(ch)
+		threshold, ids := "-", "-"
+		if r, ok := delegations[role]; ok {
+			threshold, ids = fmt.Sprint(r.Threshold), strings.Join(r.KeyIDs, ",")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", ch, role, threshold, ids)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	notarypass "github.com/docker/notary/passphrase"
+	"github.com/endophage/conman/catalog"
+	"github.com/endophage/conman/install"
+	"github.com/endophage/conman/installdb"
+	"github.com/endophage/conman/passphrase"
+	"github.com/endophage/conman/policy"
+	"github.com/mitchellh/go-homedir"
+)
+
+// config holds the settings shared by all commands. It is read from a JSON
+// file and may be overridden by global flags.
+type config struct {
+	TrustDir string `json:"trust_dir"`
+	Server   string `json:"server"`
+	GUN      string `json:"gun"`
+	// Allowlist is the file of permissions granted without asking.
+	Allowlist string `json:"allowlist"`
+	// Policy is the file of rules manifests must satisfy, defaulting to
+	// policy.DefaultFile if it exists.
+	Policy string `json:"policy"`
+
+	// ExpiryWarning is how long before trust data expires status starts
+	// warning about it, as a duration such as "72h".
+	ExpiryWarning string `json:"expiry_warning"`
+	// ExpiredTrust is what run does when the catalog's trust data has
+	// expired and cannot be refreshed: "block" refuses to run, "warn" runs
+	// the image verified at install time with a warning.
+	ExpiredTrust string `json:"expired_trust"`
+
+	// TimestampStaleness is how long the catalog's timestamp may go without
+	// advancing before conman warns that it may be frozen, as a duration
+	// such as "168h". Empty never warns.
+	TimestampStaleness string `json:"timestamp_staleness"`
+
+	// Pins are the roots of trust catalogs must be signed with, by GUN.
+	Pins map[string]*catalog.Pin `json:"pins"`
+
+	// PassphraseFile is a file of signing key passphrases by role, readable
+	// only by its owner.
+	PassphraseFile string `json:"passphrase_file"`
+
+	// Offline restricts conman to cached trust data and icons. It is only
+	// set by flag.
+	Offline bool `json:"-"`
+	// PassphraseFD, if not negative, is a file descriptor to read signing
+	// key passphrases from. It is only set by flag.
+	PassphraseFD int `json:"-"`
+
+	retriever notarypass.Retriever
+}
+
+// baseDir returns the directory conman keeps its own state in.
+func baseDir() string {
+	home, err := homedir.Dir()
+	if err != nil {
+		return ".conman"
+	}
+	return filepath.Join(home, ".conman")
+}
+
+func defaultConfigFile() string {
+	return filepath.Join(baseDir(), "config.json")
+}
+
+// loadConfig reads the config file at path, falling back to defaults for
+// anything it does not set. A missing file is not an error.
+func loadConfig(path string) (*config, error) {
+	cfg := &config{PassphraseFD: -1}
+	f, err := os.Open(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, err
+	default:
+		defer f.Close()
+		if err := json.NewDecoder(f).Decode(cfg); err != nil {
+			return nil, fmt.Errorf("parsing config %s: %v", path, err)
+		}
+	}
+
+	if cfg.TrustDir == "" {
+		cfg.TrustDir = filepath.Join(baseDir(), "trust")
+	}
+	if cfg.Server == "" {
+		cfg.Server = catalog.DefaultServer
+	}
+	if cfg.GUN == "" {
+		cfg.GUN = catalog.DefaultGUN
+	}
+	if cfg.ExpiryWarning == "" {
+		cfg.ExpiryWarning = "72h"
+	}
+	if _, err := time.ParseDuration(cfg.ExpiryWarning); err != nil {
+		return nil, fmt.Errorf("config %s: expiry_warning: %v", path, err)
+	}
+	if cfg.TimestampStaleness != "" {
+		if _, err := time.ParseDuration(cfg.TimestampStaleness); err != nil {
+			return nil, fmt.Errorf("config %s: timestamp_staleness: %v", path, err)
+		}
+	}
+	switch cfg.ExpiredTrust {
+	case "":
+		cfg.ExpiredTrust = "block"
+	case "block", "warn":
+	default:
+		return nil, fmt.Errorf("config %s: expired_trust must be block or warn, not %q", path, cfg.ExpiredTrust)
+	}
+	if cfg.TrustDir, err = homedir.Expand(cfg.TrustDir); err != nil {
+		return nil, err
+	}
+	if cfg.Allowlist, err = homedir.Expand(cfg.Allowlist); err != nil {
+		return nil, err
+	}
+	if cfg.PassphraseFile, err = homedir.Expand(cfg.PassphraseFile); err != nil {
+		return nil, err
+	}
+	for _, pin := range cfg.Pins {
+		for i, cert := range pin.Certs {
+			if pin.Certs[i], err = homedir.Expand(cert); err != nil {
+				return nil, err
+			}
+		}
+	}
+	cfg.Policy, err = homedir.Expand(cfg.Policy)
+	return cfg, err
+}
+
+// override replaces config values with any non-empty flag values.
+func (c *config) override(trustDir, server, gun string) {
+	if trustDir != "" {
+		c.TrustDir = trustDir
+	}
+	if server != "" {
+		c.Server = server
+	}
+	if gun != "" {
+		c.GUN = gun
+	}
+}
+
+// openDB opens the database of installed applications.
+func (c *config) openDB() (*installdb.DB, error) {
+	return installdb.Open(filepath.Join(baseDir(), "installed.json"))
+}
+
+// expiryWarning returns the ExpiryWarning duration.
+func (c *config) expiryWarning() time.Duration {
+	d, _ := time.ParseDuration(c.ExpiryWarning)
+	return d
+}
+
+// timestampStaleness returns the TimestampStaleness duration, zero if unset.
+func (c *config) timestampStaleness() time.Duration {
+	d, _ := time.ParseDuration(c.TimestampStaleness)
+	return d
+}
+
+// versionLogFile returns the file recording the highest metadata versions
+// verified for each catalog.
+func versionLogFile() string {
+	return filepath.Join(baseDir(), "versions.json")
+}
+
+// loadPolicy loads the system policy, if there is one, together with the
+// configured policy, whose rules are enforced on top of it. It returns a nil
+// Policy, allowing everything, if neither exists.
+func (c *config) loadPolicy() (*policy.Policy, error) {
+	system, err := policy.Load(policy.DefaultFile)
+	if os.IsNotExist(err) {
+		system = nil
+	} else if err != nil {
+		return nil, err
+	}
+	if c.Policy == "" || c.Policy == policy.DefaultFile {
+		return system, nil
+	}
+	user, err := policy.Load(c.Policy)
+	if err != nil {
+		return nil, err
+	}
+	return policy.Merge(system, user), nil
+}
+
+// openCatalog opens the configured catalog, offline if requested, and
+// verifies its root against the catalog's pin if it has one and its
+// metadata against the versions seen before.
+func (c *config) openCatalog() (*catalog.Catalog, error) {
+	cat, err := c.openUnverifiedCatalog()
+	if err != nil {
+		return nil, err
+	}
+	if err := cat.Verify(); err != nil {
+		return nil, err
+	}
+	return cat, nil
+}
+
+// openUnverifiedCatalog opens the configured catalog without checking its
+// cached trust data, for replacing trust data that fails the checks.
+func (c *config) openUnverifiedCatalog() (*catalog.Catalog, error) {
+	var rt http.RoundTripper = http.DefaultTransport
+	if c.Offline {
+		rt = nil
+	}
+	retriever, err := c.passphraseRetriever()
+	if err != nil {
+		return nil, err
+	}
+	cat, err := catalog.Open(c.TrustDir, c.Server, c.GUN, rt, retriever)
+	if err != nil {
+		return nil, err
+	}
+	cat.Pin = c.Pins[c.GUN]
+	if cat.Versions, err = catalog.OpenVersionLog(versionLogFile()); err != nil {
+		return nil, err
+	}
+	cat.Staleness = c.timestampStaleness()
+	return cat, nil
+}
+
+// passphraseRetriever returns the retriever for signing key passphrases,
+// which takes them from the environment, the passphrase file descriptor and
+// the passphrase file, in that order, before asking on the terminal. The
+// descriptor can only be read once, so the retriever is built once.
+func (c *config) passphraseRetriever() (notarypass.Retriever, error) {
+	if c.retriever != nil {
+		return c.retriever, nil
+	}
+	sources := []passphrase.Source{passphrase.Env()}
+	if c.PassphraseFD >= 0 {
+		p, err := passphrase.FD(uintptr(c.PassphraseFD))
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, p)
+	}
+	if c.PassphraseFile != "" {
+		p, err := passphrase.File(c.PassphraseFile)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, p)
+	}
+	c.retriever = passphrase.Retriever(sources...)
+	return c.retriever, nil
+}
+
+// newInstaller returns an installer, restricted to cached icons offline.
+func (c *config) newInstaller() (*install.Installer, error) {
+	inst, err := install.New()
+	if err != nil {
+		return nil, err
+	}
+	inst.Icons.Offline = c.Offline
+	return inst, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/docker/docker/pkg/term"
+	"github.com/endophage/conman/manifest"
+	"github.com/endophage/conman/permission"
+)
+
+// consentOpts are the flags controlling permission review, shared by the
+// commands that install applications.
+var consentOpts struct {
+	yes       bool
+	allowlist string
+}
+
+func consentFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&consentOpts.yes, "yes", false, "grant the requested permissions without asking")
+	fs.StringVar(&consentOpts.allowlist, "allowlist", "", "file of permissions to grant without asking (default from config)")
+}
+
+// loadAllowlist loads the allowlist named by the -allowlist flag or the
+// config, if any.
+func (c *config) loadAllowlist(h *manifest.Host) (*permission.Allowlist, error) {
+	path := consentOpts.allowlist
+	if path == "" {
+		path = c.Allowlist
+	}
+	if path == "" {
+		return nil, nil
+	}
+	return permission.LoadAllowlist(path, h)
+}
+
+// errNotApproved is returned when the user declines an application's
+// permissions, or they cannot be asked for approval.
+type errNotApproved struct {
+	App        string
+	Unapproved []permission.Permission
+}
+
+func (err errNotApproved) Error() string {
+	return fmt.Sprintf("%s needs permissions that were not granted: %s", err.App, strings.Join(permission.IDs(err.Unapproved), ", "))
+}
+
+// confirmPermissions shows the permissions an application requests under
+// intro, and asks question to have the user grant those the allowlist does
+// not. It fails without asking when standard input is not a terminal, unless
+// -yes was given.
+func confirmPermissions(intro, question, app string, perms []permission.Permission, allow *permission.Allowlist) error {
+	if len(perms) == 0 {
+		return nil
+	}
+	unapproved := allow.Unapproved(app, perms)
+
+	fmt.Println(intro)
+	for _, p := range perms {
+		if allow.Allows(app, p) {
+			fmt.Printf("  %s (allowlisted)\n", p)
+		} else {
+			fmt.Printf("  %s\n", p)
+		}
+	}
+	if len(unapproved) == 0 || consentOpts.yes {
+		return nil
+	}
+	if !term.IsTerminal(os.Stdin.Fd()) {
+		return errNotApproved{App: app, Unapproved: unapproved}
+	}
+	if !ask(question) {
+		return errNotApproved{App: app, Unapproved: unapproved}
+	}
+	return nil
+}
+
+// ask asks a yes or no question on the terminal, defaulting to no.
+func ask(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
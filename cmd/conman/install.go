@@ -0,0 +1,126 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/endophage/conman/catalog"
+	"github.com/endophage/conman/manifest"
+	"github.com/endophage/conman/permission"
+)
+
+var installOpts struct {
+	setDefault bool
+	channel    string
+}
+
+var cmdInstall = &command{
+	name:  "install",
+	args:  "[OPTIONS] <app>",
+	short: "Install a signed application from the catalog onto the desktop",
+	flags: func(fs *flag.FlagSet) {
+		fs.BoolVar(&installOpts.setDefault, "default", false, "make the app the default handler for its MIME types")
+		fs.StringVar(&installOpts.channel, "channel", "", "release channel to install from: "+strings.Join(catalog.Channels, ", ")+" (default stable, or the installed app's)")
+		consentFlags(fs)
+	},
+	run: runInstall,
+}
+
+func runInstall(cfg *config, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	name := args[0]
+
+	db, err := cfg.openDB()
+	if err != nil {
+		return err
+	}
+	cat, err := cfg.openCatalog()
+	if err != nil {
+		return err
+	}
+	// reinstalls stay on the installed app's channel unless told otherwise
+	cat.Channel = installOpts.channel
+	prev := db.Get(name)
+	if cat.Channel == "" && prev != nil {
+		cat.Channel = prev.Channel
+	}
+	app, err := cat.Lookup(name)
+	if err != nil {
+		return err
+	}
+	warnLegacy(app)
+	host, err := manifest.CurrentHost()
+	if err != nil {
+		return err
+	}
+	pol, err := cfg.loadPolicy()
+	if err != nil {
+		return err
+	}
+	if err := pol.Evaluate(app.Name, cfg.GUN, app.Manifest, host); err != nil {
+		return err
+	}
+	allow, err := cfg.loadAllowlist(host)
+	if err != nil {
+		return err
+	}
+	perms, err := permission.Review(app.Manifest, host)
+	if err != nil {
+		return fmt.Errorf("%s: %v", app.Name, err)
+	}
+	intro := fmt.Sprintf("%s requests access to:", app.Name)
+	question := fmt.Sprintf("Install %s with these permissions?", app.Name)
+	if err := confirmPermissions(intro, question, app.Name, perms, allow); err != nil {
+		return err
+	}
+
+	inst, err := cfg.newInstaller()
+	if err != nil {
+		return err
+	}
+	rec, err := inst.Install(app, installOpts.setDefault)
+	if err != nil {
+		return err
+	}
+	if cat.Channel != catalog.Stable {
+		rec.Channel = cat.Channel
+	}
+	if prev != nil {
+		// reinstalling: drop anything the old install wrote that this one
+		// did not
+		inst.RemoveStale(prev, rec)
+	}
+	db.Put(rec)
+	if err := db.Save(); err != nil {
+		return err
+	}
+
+	if rec.Channel != "" {
+		fmt.Printf("Installed %s from the %s channel, signed by %s\n", app.Name, rec.Channel, app.Role)
+	} else {
+		fmt.Printf("Installed %s, signed by %s\n", app.Name, app.Role)
+	}
+	for _, f := range rec.Files {
+		fmt.Printf("  %s\n", f)
+	}
+	if len(rec.MimeTypes) > 0 {
+		handler := "handler"
+		if rec.DefaultHandler {
+			handler = "default handler"
+		}
+		fmt.Printf("Registered as %s for %s\n", handler, strings.Join(rec.MimeTypes, ", "))
+	}
+	return nil
+}
+
+// warnLegacy warns if the app has a legacy manifest, whose raw Exec command
+// launches its image by tag rather than by the digest the catalog verified.
+func warnLegacy(app *catalog.App) {
+	if app.Manifest.Run == nil {
+		logrus.Warnf("%s has a legacy manifest with a raw Exec command: it launches its image by tag, not by the digest verified by the catalog", app.Name)
+	}
+}
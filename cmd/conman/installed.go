@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/endophage/conman/catalog"
+	"github.com/endophage/conman/installdb"
+	"github.com/endophage/conman/manifest"
+	"github.com/endophage/conman/permission"
+)
+
+var cmdInstalled = &command{
+	name:  "installed",
+	args:  "",
+	short: "List the applications installed by conman",
+	run:   runInstalled,
+}
+
+var cmdUpdate = &command{
+	name:  "update",
+	args:  "[OPTIONS] [app...]",
+	short: "Update installed applications to their latest catalog targets",
+	flags: consentFlags,
+	run:   runUpdate,
+}
+
+var cmdRemove = &command{
+	name:  "remove",
+	args:  "<app...>",
+	short: "Remove installed applications and every file conman wrote for them",
+	run:   runRemove,
+}
+
+func runInstalled(cfg *config, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	db, err := cfg.openDB()
+	if err != nil {
+		return err
+	}
+	records := db.List()
+	if len(records) == 0 {
+		fmt.Println("No applications installed.")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tCHANNEL\tROLE\tDIGEST\tINSTALLED")
+	for _, r := range records {
+		channel := r.Channel
+		if channel == "" {
+			channel = catalog.Stable
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\tsha256:%.12s\t%s\n", r.Name, channel, r.Role, r.Digest, r.InstalledAt.Format("2006-01-02 15:04"))
+	}
+	return w.Flush()
+}
+
+// installedRecords returns the records for the named applications, or for
+// every installed application if no names are given.
+func installedRecords(db *installdb.DB, names []string) ([]*installdb.Record, error) {
+	if len(names) == 0 {
+		return db.List(), nil
+	}
+	var records []*installdb.Record
+	for _, name := range names {
+		r := db.Get(name)
+		if r == nil {
+			return nil, fmt.Errorf("%s is not installed", name)
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+func runUpdate(cfg *config, args []string) error {
+	db, err := cfg.openDB()
+	if err != nil {
+		return err
+	}
+	records, err := installedRecords(db, args)
+	if err != nil {
+		return err
+	}
+	cat, err := cfg.openCatalog()
+	if err != nil {
+		return err
+	}
+	inst, err := cfg.newInstaller()
+	if err != nil {
+		return err
+	}
+	host, err := manifest.CurrentHost()
+	if err != nil {
+		return err
+	}
+	pol, err := cfg.loadPolicy()
+	if err != nil {
+		return err
+	}
+	allow, err := cfg.loadAllowlist(host)
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for _, prev := range records {
+		cat.Channel = prev.Channel
+		app, err := cat.Lookup(prev.Name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", prev.Name, err)
+			failed++
+			continue
+		}
+		if err := pol.Evaluate(app.Name, cfg.GUN, app.Manifest, host); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", prev.Name, err)
+			failed++
+			continue
+		}
+		warnLegacy(app)
+		if err := reviewUpdate(prev, app, host, allow); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", prev.Name, err)
+			failed++
+			continue
+		}
+		rec, changed, err := inst.Update(prev, app)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", prev.Name, err)
+			failed++
+			continue
+		}
+		if !changed {
+			fmt.Printf("%s is up to date\n", prev.Name)
+			continue
+		}
+		rec.Channel = prev.Channel
+		db.Put(rec)
+		fmt.Printf("Updated %s, signed by %s\n", prev.Name, rec.Role)
+	}
+	if err := db.Save(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d application(s) failed to update", failed)
+	}
+	return nil
+}
+
+// reviewUpdate asks for consent to any permissions an updated manifest
+// requests beyond those of the installed one. Updates that keep or reduce
+// the application's access go ahead without asking.
+func reviewUpdate(prev *installdb.Record, app *catalog.App, h *manifest.Host, allow *permission.Allowlist) error {
+	hash, err := app.Manifest.Digest()
+	if err != nil || hash == prev.ManifestHash {
+		return err
+	}
+	perms, err := permission.Review(app.Manifest, h)
+	if err != nil {
+		return err
+	}
+
+	var granted []permission.Permission
+	if old, err := manifest.FromCustom(prev.Manifest); err != nil {
+		logrus.Warnf("%s: cannot review the installed manifest, treating every permission as new: %v", prev.Name, err)
+	} else if granted, err = permission.Review(old, h); err != nil {
+		logrus.Warnf("%s: cannot review the installed manifest, treating every permission as new: %v", prev.Name, err)
+	}
+	escalations := permission.Escalations(granted, perms)
+
+	intro := fmt.Sprintf("The new version of %s requests more access than the installed one:", app.Name)
+	question := fmt.Sprintf("Update %s anyway?", app.Name)
+	return confirmPermissions(intro, question, app.Name, escalations, allow)
+}
+
+func runRemove(cfg *config, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	db, err := cfg.openDB()
+	if err != nil {
+		return err
+	}
+	records, err := installedRecords(db, args)
+	if err != nil {
+		return err
+	}
+	inst, err := cfg.newInstaller()
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		if err := inst.Remove(r); err != nil {
+			// keep the record so a retry can finish the job
+			db.Save()
+			return err
+		}
+		db.Delete(r.Name)
+		fmt.Printf("Removed %s\n", r.Name)
+	}
+	return db.Save()
+}
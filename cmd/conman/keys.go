@@ -0,0 +1,84 @@
+package main
+
+import (
+	"archive/zip"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+var cmdKeys = &command{
+	name:  "keys",
+	args:  "export <file.zip> | import <file.zip>",
+	short: "Back up or restore the catalog's signing keys",
+	flags: keysFlags,
+	run:   runKeys,
+}
+
+var keysOpts struct {
+	all bool
+}
+
+func keysFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&keysOpts.all, "all", false, "include root keys and keys for other collections")
+}
+
+func runKeys(cfg *config, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	cat, err := cfg.openUnverifiedCatalog()
+	if err != nil {
+		return err
+	}
+	// passphrases come from the same sources as for signing, so backups
+	// can be scripted
+	retriever, err := cfg.passphraseRetriever()
+	if err != nil {
+		return err
+	}
+	switch sub, file := args[0], args[1]; sub {
+	case "export":
+		// never overwrite an existing backup
+		f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return err
+		}
+		err = cat.ExportKeys(f, keysOpts.all, retriever)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(file)
+			return err
+		}
+		fmt.Printf("Exported keys to %s\n", file)
+	case "import":
+		zr, err := zip.OpenReader(file)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		keys, err := cat.ImportKeys(&zr.Reader, keysOpts.all, retriever)
+		if err != nil {
+			return fmt.Errorf("importing keys from %s: %v", file, err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "GUN\tROLE\tKEY")
+		for _, k := range keys {
+			gun := k.GUN
+			if gun == "" {
+				gun = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", gun, k.Role, k.ID)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		fmt.Printf("Imported %d keys from %s\n", len(keys), file)
+	default:
+		return errUsage
+	}
+	return nil
+}
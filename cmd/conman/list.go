@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/endophage/conman/catalog"
+)
+
+var listOpts struct {
+	json     bool
+	mimeType string
+	channel  string
+}
+
+var cmdList = &command{
+	name:  "list",
+	args:  "[OPTIONS]",
+	short: "List the applications in the catalog",
+	flags: listFlags,
+	run:   runList,
+}
+
+var cmdSearch = &command{
+	name:  "search",
+	args:  "[OPTIONS] [query]",
+	short: "Search the catalog by name or MIME type",
+	flags: listFlags,
+	run:   runList,
+}
+
+func listFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&listOpts.json, "json", false, "print the catalog as JSON")
+	fs.StringVar(&listOpts.mimeType, "mime", "", "only show apps handling this MIME type")
+	fs.StringVar(&listOpts.channel, "channel", "", "release channel to list: "+strings.Join(catalog.Channels, ", ")+" (default stable)")
+}
+
+// appInfo is the listing of a single catalog app.
+type appInfo struct {
+	Name      string   `json:"name"`
+	Title     string   `json:"title,omitempty"`
+	Role      string   `json:"role"`
+	Digest    string   `json:"digest"`
+	Size      int64    `json:"size"`
+	Icon      string   `json:"icon,omitempty"`
+	MimeTypes []string `json:"mimetypes,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+func newAppInfo(app *catalog.App) appInfo {
+	info := appInfo{
+		Name:   app.Name,
+		Role:   app.Role,
+		Digest: "sha256:" + hex.EncodeToString(app.Hashes["sha256"]),
+		Size:   app.Length,
+	}
+	if app.Invalid != nil {
+		info.Error = app.Invalid.Error()
+		return info
+	}
+	info.Title = app.Manifest.DesktopValue("Name")
+	info.Icon = app.Manifest.DesktopValue("Icon")
+	info.MimeTypes = app.Manifest.MimeTypes
+	return info
+}
+
+func runList(cfg *config, args []string) error {
+	var query string
+	switch len(args) {
+	case 0:
+	case 1:
+		query = args[0]
+	default:
+		return errUsage
+	}
+
+	cat, err := cfg.openCatalog()
+	if err != nil {
+		return err
+	}
+	cat.Channel = listOpts.channel
+	apps, err := cat.List()
+	if err != nil {
+		return err
+	}
+
+	infos := []appInfo{}
+	for _, app := range apps {
+		if app.Matches(query, listOpts.mimeType) {
+			infos = append(infos, newAppInfo(app))
+		}
+	}
+
+	if listOpts.json {
+		enc := json.NewEncoder(os.Stdout)
+		return enc.Encode(infos)
+	}
+	if len(infos) == 0 {
+		fmt.Println("No matching applications.")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTITLE\tROLE\tDIGEST\tSIZE\tMIMETYPES")
+	for _, info := range infos {
+		title := info.Title
+		if info.Error != "" {
+			title = "(invalid manifest)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%.19s\t%d\t%s\n",
+			info.Name, title, info.Role, info.Digest, info.Size, strings.Join(info.MimeTypes, ","))
+	}
+	return w.Flush()
+}
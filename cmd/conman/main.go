@@ -0,0 +1,130 @@
+// Command conman installs and runs containerized desktop applications
+// published to a signed notary catalog.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// errUsage is returned by commands invoked with the wrong arguments.
+var errUsage = errors.New("invalid arguments")
+
+// command is a conman subcommand.
+type command struct {
+	name  string
+	args  string
+	short string
+	// flags, when set, registers the command's flags.
+	flags func(fs *flag.FlagSet)
+	run   func(cfg *config, args []string) error
+	// online is set for commands that cannot work from cached trust data.
+	online bool
+}
+
+var commands = []*command{
+	cmdInstall,
+	cmdPublish,
+	cmdRun,
+	cmdList,
+	cmdSearch,
+	cmdInstalled,
+	cmdUpdate,
+	cmdRemove,
+	cmdPublisher,
+	cmdChannel,
+	cmdStatus,
+	cmdTrust,
+	cmdKeys,
+	cmdBundle,
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: conman [OPTIONS] COMMAND [ARGS...]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.short)
+	}
+	fmt.Fprintf(os.Stderr, "\nOptions:\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	var (
+		configFile = flag.String("c", defaultConfigFile(), "path to the conman config file")
+		trustDir   = flag.String("d", "", "directory to cache trust data in")
+		server     = flag.String("s", "", "notary server hosting the catalog")
+		gun        = flag.String("gun", "", "trusted collection holding the catalog")
+		debug      = flag.Bool("D", false, "enable debug logging")
+		offline    = flag.Bool("offline", false, "only use cached trust data and icons")
+		passFD     = flag.Int("passphrase-fd", -1, "file descriptor to read signing key passphrases from")
+		passFile   = flag.String("passphrase-file", "", "file of signing key passphrases, mode 0600")
+	)
+	flag.Usage = usage
+	flag.Parse()
+
+	if *debug {
+		logrus.SetLevel(logrus.DebugLevel)
+	}
+
+	args := flag.Args()
+	if len(args) == 0 {
+		usage()
+		os.Exit(2)
+	}
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "conman: unknown command %q\n", args[0])
+		usage()
+		os.Exit(2)
+	}
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	cfg.override(*trustDir, *server, *gun)
+	cfg.Offline = *offline
+	cfg.PassphraseFD = *passFD
+	if *passFile != "" {
+		cfg.PassphraseFile = *passFile
+	}
+	if cfg.Offline && cmd.online {
+		fatalf("%s cannot be used offline", cmd.name)
+	}
+
+	fs := flag.NewFlagSet(cmd.name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: conman %s %s\n\n%s\n", cmd.name, cmd.args, cmd.short)
+		fs.PrintDefaults()
+	}
+	if cmd.flags != nil {
+		cmd.flags(fs)
+	}
+	fs.Parse(args[1:])
+
+	if err := cmd.run(cfg, fs.Args()); err != nil {
+		if err == errUsage {
+			fs.Usage()
+			os.Exit(2)
+		}
+		fatalf("%v", err)
+	}
+}
+
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "conman: "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/notary/tuf/data"
+	"github.com/endophage/conman/catalog"
+	"github.com/endophage/conman/publish"
+	"github.com/endophage/conman/registry"
+	"github.com/riyazdf/notary/client"
+)
+
+var publishOpts struct {
+	lockFile  string
+	dryRun    bool
+	resolve   bool
+	registry  string
+	insecure  bool
+	publisher string
+	channel   string
+	bundle    string
+}
+
+var cmdPublish = &command{
+	name:  "publish",
+	args:  "[OPTIONS] <dir>",
+	short: "Publish the manifests in a directory to the catalog",
+	flags: func(fs *flag.FlagSet) {
+		fs.StringVar(&publishOpts.lockFile, "lock", "", "lockfile of image digests (default <dir>/"+publish.LockFileName+")")
+		fs.BoolVar(&publishOpts.dryRun, "n", false, "show what would change without publishing")
+		fs.BoolVar(&publishOpts.resolve, "resolve", true, "resolve image digests from the registry and update the lockfile, or with -resolve=false publish the lockfile as is")
+		fs.StringVar(&publishOpts.registry, "registry", "", "registry to resolve images without a registry host from")
+		fs.BoolVar(&publishOpts.insecure, "insecure-registry", false, "resolve images over plain HTTP")
+		fs.StringVar(&publishOpts.publisher, "publisher", "", "sign the targets as this publisher's delegation instead of the base targets role")
+		fs.StringVar(&publishOpts.channel, "channel", "", "publish to this release channel's delegation")
+		fs.StringVar(&publishOpts.bundle, "bundle", "", "write the changes to this file for the delegation's signers instead of publishing")
+	},
+	run:    runPublish,
+	online: true,
+}
+
+func runPublish(cfg *config, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	dir := args[0]
+	lockFile := publishOpts.lockFile
+	if lockFile == "" {
+		lockFile = filepath.Join(dir, publish.LockFileName)
+	}
+
+	lock, err := publish.LoadLock(lockFile)
+	if err != nil {
+		return err
+	}
+	releases, err := publish.LoadDir(dir, lock)
+	if err != nil {
+		return err
+	}
+	if publishOpts.resolve {
+		reg := registry.NewClient()
+		reg.Registry = publishOpts.registry
+		reg.Insecure = publishOpts.insecure
+		if err := publish.Resolve(releases, lock, reg); err != nil {
+			return err
+		}
+		if !publishOpts.dryRun {
+			if err := lock.Save(lockFile); err != nil {
+				return err
+			}
+		}
+	} else if names := publish.Unresolved(releases); len(names) > 0 {
+		return fmt.Errorf("%s: no image digest for %s, publish without -resolve=false to look them up", lockFile, strings.Join(names, ", "))
+	}
+
+	cat, err := cfg.openCatalog()
+	if err != nil {
+		return err
+	}
+	var role string
+	switch {
+	case publishOpts.publisher != "" && publishOpts.channel != "":
+		return fmt.Errorf("-publisher and -channel cannot be combined")
+	case publishOpts.publisher != "":
+		if role, err = assignPublisher(cat, publishOpts.publisher, releases); err != nil {
+			return err
+		}
+	case publishOpts.channel != "":
+		if role, err = catalog.ChannelRole(publishOpts.channel); err != nil {
+			return err
+		}
+		for _, r := range releases {
+			r.Role = role
+		}
+	case publishOpts.bundle != "":
+		return fmt.Errorf("-bundle needs the -publisher or -channel whose signers sign it")
+	}
+	if role != "" && publishOpts.bundle == "" {
+		threshold, err := cat.RoleThreshold(role)
+		if err != nil {
+			return err
+		}
+		if threshold > 1 {
+			return fmt.Errorf("%s needs %d signatures, stage the changes with -bundle for its signers to sign", role, threshold)
+		}
+	}
+	dest := role
+	if dest == "" {
+		dest = data.CanonicalTargetsRole
+	}
+	current, err := cat.PublishedTargets(dest)
+	if _, ok := err.(client.ErrRepositoryNotExist); ok {
+		current = nil
+	} else if err != nil {
+		return err
+	}
+
+	changes := publish.Diff(current, releases)
+	pending := 0
+	for _, c := range changes {
+		fmt.Println(c)
+		if c.Kind == publish.Added || c.Kind == publish.Updated {
+			pending++
+		}
+	}
+	if pending == 0 {
+		fmt.Println("Nothing to publish.")
+		return nil
+	}
+	if publishOpts.dryRun {
+		return nil
+	}
+	if publishOpts.bundle != "" {
+		return stageBundle(cat, role, changes, pending)
+	}
+
+	if _, err := publish.Stage(cat.Repo, changes); err != nil {
+		return err
+	}
+	if err := cat.Repo.Publish(); err != nil {
+		return err
+	}
+	fmt.Printf("Published %d change(s) to %s\n", pending, cat.GUN)
+	return nil
+}
+
+// assignPublisher signs every release as the named publisher, after checking
+// that its delegation covers them, and returns the publisher's role.
+func assignPublisher(cat *catalog.Catalog, publisher string, releases []*publish.Release) (string, error) {
+	role, err := catalog.PublisherRole(publisher)
+	if err != nil {
+		return "", err
+	}
+	pub, err := cat.Publisher(role)
+	if err != nil {
+		return "", err
+	}
+	if pub == nil {
+		return "", fmt.Errorf("%s has no publisher %s, a catalog admin must add it with conman publisher add", cat.GUN, publisher)
+	}
+	for _, r := range releases {
+		if !pub.CanSign(r.Target.Name) {
+			return "", fmt.Errorf("publisher %s may not sign %s, its delegation only covers %s", publisher, r.Target.Name, strings.Join(pub.Apps, ", "))
+		}
+		r.Role = role
+	}
+	return role, nil
+}
+
+// stageBundle writes the added and updated releases to a bundle of role's
+// next targets for its signers, rather than publishing them.
+func stageBundle(cat *catalog.Catalog, role string, changes []publish.Change, pending int) error {
+	files := make(data.Files)
+	for _, c := range changes {
+		if c.Kind != publish.Added && c.Kind != publish.Updated {
+			continue
+		}
+		// a bundle only holds the metadata of one role
+		if c.Current != nil && c.Current.Role != role {
+			return fmt.Errorf("%s is signed by %s, it must be removed from there before it can be bundled for %s", c.Name, c.Current.Role, role)
+		}
+		files[c.Name] = data.FileMeta{Length: c.Release.Target.Length, Hashes: c.Release.Target.Hashes, Custom: c.Release.Custom}
+	}
+	bundle, err := cat.StageBundle(role, files)
+	if err != nil {
+		return err
+	}
+	if err := bundle.Save(publishOpts.bundle); err != nil {
+		return err
+	}
+	threshold, err := cat.RoleThreshold(role)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Staged %d change(s) to %s in %s, which needs %d signature(s): conman bundle sign %s\n", pending, role, publishOpts.bundle, threshold, publishOpts.bundle)
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/docker/notary/tuf/data"
+	"github.com/endophage/conman/catalog"
+)
+
+var cmdPublisher = &command{
+	name:   "publisher",
+	args:   "list | [-threshold N] add <publisher> <cert.pem>[,<cert.pem>...] <app...> | remove <publisher> [app...]",
+	short:  "Manage the delegations allowed to sign individual apps",
+	flags:  delegationFlags,
+	run:    runPublisher,
+	online: true,
+}
+
+var delegationOpts struct {
+	threshold int
+}
+
+func delegationFlags(fs *flag.FlagSet) {
+	fs.IntVar(&delegationOpts.threshold, "threshold", 1, "signatures needed from the delegation's keys, only set when it is created")
+}
+
+func runPublisher(cfg *config, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	cat, err := cfg.openCatalog()
+	if err != nil {
+		return err
+	}
+	switch sub, args := args[0], args[1:]; {
+	case sub == "list" && len(args) == 0:
+		return listPublishers(cat)
+	case sub == "add" && len(args) >= 3:
+		keys, err := loadKeys(args[1])
+		if err != nil {
+			return err
+		}
+		if err := cat.AddPublisher(args[0], keys, args[2:], delegationOpts.threshold); err != nil {
+			return err
+		}
+		if err := cat.Repo.Publish(); err != nil {
+			return err
+		}
+		fmt.Printf("Publisher %s may now sign %s with %s\n", args[0], strings.Join(args[2:], ", "), describeKeys(keys, delegationOpts.threshold))
+	case sub == "remove" && len(args) >= 1:
+		if err := cat.RemovePublisher(args[0], args[1:]); err != nil {
+			return err
+		}
+		if err := cat.Repo.Publish(); err != nil {
+			return err
+		}
+		if len(args) == 1 {
+			fmt.Printf("Removed publisher %s\n", args[0])
+		} else {
+			fmt.Printf("Publisher %s may no longer sign %s\n", args[0], strings.Join(args[1:], ", "))
+		}
+	default:
+		return errUsage
+	}
+	return nil
+}
+
+func listPublishers(cat *catalog.Catalog) error {
+	pubs, err := cat.Publishers()
+	if err != nil {
+		return err
+	}
+	if len(pubs) == 0 {
+		fmt.Printf("%s has no publishers, every app is signed by the base targets role.\n", cat.GUN)
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PUBLISHER\tROLE\tAPPS\tTHRESHOLD\tKEYS")
+	for _, p := range pubs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", p.Name, p.Role, strings.Join(p.Apps, ","), p.Threshold, strings.Join(p.KeyIDs, ","))
+	}
+	return w.Flush()
+}
+
+// loadKeys reads the public keys of a delegation from a comma separated
+// list of certificate files.
+func loadKeys(paths string) ([]data.PublicKey, error) {
+	var keys []data.PublicKey
+	for _, path := range strings.Split(paths, ",") {
+		key, err := catalog.LoadPublisherKey(path)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func describeKeys(keys []data.PublicKey, threshold int) string {
+	ids := make([]string, len(keys))
+	for i, k := range keys {
+		ids[i] = k.ID()
+	}
+	if len(keys) == 1 {
+		return "key " + ids[0]
+	}
+	if threshold > 1 {
+		return fmt.Sprintf("keys %s, %d of which must sign", strings.Join(ids, ", "), threshold)
+	}
+	return "keys " + strings.Join(ids, ", ")
+}
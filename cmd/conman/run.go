@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/notary/tuf/data"
+	"github.com/endophage/conman/catalog"
+	"github.com/endophage/conman/installdb"
+	"github.com/endophage/conman/manifest"
+	"github.com/riyazdf/notary/client"
+)
+
+var cmdRun = &command{
+	name:  "run",
+	args:  "<app>",
+	short: "Launch an application by its verified image digest",
+	run:   runRun,
+}
+
+func runRun(cfg *config, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	name := args[0]
+
+	// Lookup updates the trust data first, and only falls back to the
+	// cache, as it does offline, while the cached metadata is unexpired.
+	cat, err := cfg.openCatalog()
+	if err != nil {
+		return err
+	}
+	// only installed apps are run, from the channel they were installed
+	// from and with the manifest whose access the user consented to
+	db, err := cfg.openDB()
+	if err != nil {
+		return err
+	}
+	rec := db.Get(name)
+	if rec == nil {
+		return fmt.Errorf("refusing to run %s: it is not installed, install it with conman install %s", name, name)
+	}
+	cat.Channel = rec.Channel
+	app, err := cat.Lookup(name)
+	if err != nil {
+		if app, err = lapsedApp(cfg, cat, rec, err); err != nil {
+			return fmt.Errorf("refusing to run %s: %v", name, err)
+		}
+	}
+	hash, err := app.Manifest.Digest()
+	if err != nil {
+		return err
+	}
+	if hash != rec.ManifestHash {
+		return fmt.Errorf("refusing to run %s: its manifest changed since it was installed, run conman update to review the change", name)
+	}
+	if app.Manifest, err = manifest.FromCustom(rec.Manifest); err != nil {
+		return fmt.Errorf("refusing to run %s: invalid installed manifest: %v", name, err)
+	}
+	if app.Manifest.Run == nil {
+		return fmt.Errorf("refusing to run %s: its manifest has no run spec to pin an image in", name)
+	}
+	image, err := app.PinnedImage()
+	if err != nil {
+		return fmt.Errorf("refusing to run %s: %v", name, err)
+	}
+
+	host, err := manifest.CurrentHost()
+	if err != nil {
+		return err
+	}
+	// the policy may have changed since the app was installed
+	pol, err := cfg.loadPolicy()
+	if err != nil {
+		return err
+	}
+	if err := pol.Evaluate(name, cfg.GUN, app.Manifest, host); err != nil {
+		return fmt.Errorf("refusing to run %s: %v", name, err)
+	}
+	spec := *app.Manifest.Run
+	spec.Image = image
+	argv, err := spec.Args(host)
+	if err != nil {
+		return err
+	}
+	logrus.Debugf("running %v", argv)
+
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+				os.Exit(status.ExitStatus())
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// lapsedApp handles a failed lookup of an installed application. If the
+// lookup failed because the catalog's trust data has expired and the config
+// allows it, it returns the application as verified at install time with a
+// warning. Otherwise it returns the reason the lookup failed.
+func lapsedApp(cfg *config, cat *catalog.Catalog, rec *installdb.Record, lookupErr error) (*catalog.App, error) {
+	if _, ok := lookupErr.(catalog.ErrAppNotFound); ok {
+		return nil, lookupErr
+	}
+	expired, ok := cat.CheckCache(time.Now()).(catalog.ErrCacheExpired)
+	if !ok {
+		return nil, lookupErr
+	}
+	if cfg.ExpiredTrust != "warn" {
+		return nil, expired
+	}
+
+	m, err := manifest.FromCustom(rec.Manifest)
+	if err != nil {
+		return nil, expired
+	}
+	digest, err := hex.DecodeString(rec.Digest)
+	if err != nil {
+		return nil, expired
+	}
+	logrus.Warnf("%v; running %s as verified on %s", expired, rec.Name, rec.InstalledAt.Local().Format("2006-01-02 15:04"))
+	return &catalog.App{
+		Target: client.Target{
+			Name:   rec.Name,
+			Hashes: data.Hashes{"sha256": digest},
+		},
+		Role:     rec.Role,
+		Manifest: m,
+	}, nil
+}
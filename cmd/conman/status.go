@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/notary/tuf/data"
+	"github.com/endophage/conman/catalog"
+)
+
+var cmdStatus = &command{
+	name:  "status",
+	args:  "",
+	short: "Show the freshness of the catalog's trust data",
+	run:   runStatus,
+}
+
+func runStatus(cfg *config, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	cat, err := cfg.openCatalog()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Catalog: %s\n", cat.GUN)
+	if cat.Offline {
+		fmt.Println("Server:  offline, showing cached trust data")
+	} else {
+		fmt.Printf("Server:  %s\n", cfg.Server)
+	}
+	_, updateErr := cat.Repo.Update(false)
+	if updateErr != nil {
+		fmt.Printf("Update:  failed: %v\n", updateErr)
+	} else {
+		fmt.Println("Update:  ok")
+	}
+	fmt.Println()
+
+	roles, err := cat.CachedRoles()
+	if err != nil {
+		return err
+	}
+	if len(roles) == 0 {
+		return catalog.ErrNotCached{GUN: cat.GUN}
+	}
+	now := time.Now()
+	var expired, warnings int
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ROLE\tVERSION\tEXPIRES\tSTATUS")
+	for _, r := range roles {
+		status := "ok"
+		switch {
+		case r.Expired(now):
+			status = "EXPIRED"
+			expired++
+		case r.Role == data.CanonicalRootRole && r.NearExpiry(now, 0):
+			status = "near expiry, re-signed on the next publish"
+			warnings++
+		case r.NearExpiry(now, cfg.expiryWarning()):
+			status = fmt.Sprintf("expires in %s", until(now, r.Expires))
+			warnings++
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", r.Role, r.Version, r.Expires.Local().Format("2006-01-02 15:04"), status)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if err := cat.CheckVersions(now); err != nil {
+		return err
+	}
+	if err := cat.Frozen(now); err != nil && !cat.Offline {
+		fmt.Printf("\nWarning: %v\n", err)
+	}
+
+	if expired > 0 {
+		if cfg.ExpiredTrust == "warn" {
+			return fmt.Errorf("the trust data for %s has expired, installs and updates will fail until it is refreshed and installed apps run as verified at install time", cat.GUN)
+		}
+		return fmt.Errorf("the trust data for %s has expired, installs and launches will fail until it is refreshed", cat.GUN)
+	}
+	if warnings > 0 {
+		fmt.Printf("\nSome trust data for %s expires soon.\n", cat.GUN)
+	}
+	return updateErr
+}
+
+// until formats the time from now to t, rounded to minutes.
+func until(now, t time.Time) string {
+	return (t.Sub(now) / time.Minute * time.Minute).String()
+}
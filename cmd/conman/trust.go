@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/pkg/term"
+	"github.com/endophage/conman/catalog"
+)
+
+var cmdTrust = &command{
+	name:  "trust",
+	args:  "show | reset -reason <reason>",
+	short: "Show or reset the catalog's root of trust",
+	flags: trustFlags,
+	run:   runTrust,
+}
+
+var trustOpts struct {
+	reason         string
+	yes            bool
+	forgetVersions bool
+}
+
+func trustFlags(fs *flag.FlagSet) {
+	fs.StringVar(&trustOpts.reason, "reason", "", "why the root of trust is being reset, recorded in the audit log")
+	fs.BoolVar(&trustOpts.yes, "yes", false, "reset without asking for confirmation")
+	fs.BoolVar(&trustOpts.forgetVersions, "forget-versions", false, "also forget the metadata versions seen before, accepting older ones")
+}
+
+func runTrust(cfg *config, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	cat, err := cfg.openUnverifiedCatalog()
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "show":
+		return showTrust(cat)
+	case "reset":
+		if cfg.Offline {
+			return errors.New("trust reset cannot be used offline")
+		}
+		return resetTrust(cfg, cat)
+	}
+	return errUsage
+}
+
+func showTrust(cat *catalog.Catalog) error {
+	ids, err := cat.RootKeyIDs()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Catalog:   %s\n", cat.GUN)
+	if len(ids) == 0 {
+		fmt.Println("Root keys: none, no root of trust is cached")
+	} else {
+		fmt.Printf("Root keys: %s\n", strings.Join(ids, ", "))
+	}
+	if cat.Pin == nil {
+		fmt.Println("Pin:       none, the first root fetched is trusted")
+	} else {
+		fmt.Println("Pin:       configured")
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := cat.Verify(); err != nil {
+		fmt.Printf("Checks:    FAILED: %v\n", err)
+		return err
+	}
+	fmt.Println("Checks:    ok")
+	return nil
+}
+
+// trustAudit is an entry in the trust reset audit log.
+type trustAudit struct {
+	Time           time.Time `json:"time"`
+	User           string    `json:"user"`
+	GUN            string    `json:"gun"`
+	Server         string    `json:"server"`
+	Reason         string    `json:"reason"`
+	OldRootKeys    []string  `json:"old_root_keys"`
+	NewRootKeys    []string  `json:"new_root_keys,omitempty"`
+	ForgotVersions bool      `json:"forgot_versions,omitempty"`
+	Result         string    `json:"result"`
+}
+
+func trustLogFile() string {
+	return filepath.Join(baseDir(), "trust.log")
+}
+
+// resetTrust deletes the catalog's cached trust data and fetches its root
+// again, checked against the pin, recording the reset in the audit log
+// whether it succeeds or not.
+func resetTrust(cfg *config, cat *catalog.Catalog) error {
+	if strings.TrimSpace(trustOpts.reason) == "" {
+		return errors.New("trust reset requires a -reason for the audit log")
+	}
+	old, err := cat.RootKeyIDs()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Resetting the root of trust for %s\n", cat.GUN)
+	if len(old) > 0 {
+		fmt.Printf("Current root keys: %s\n", strings.Join(old, ", "))
+	}
+	if trustOpts.forgetVersions {
+		fmt.Println("The metadata versions seen before will be forgotten, so an older catalog will be accepted.")
+	}
+	if cat.Pin == nil {
+		fmt.Println("No pin is configured, so whatever root the server now serves will be trusted.")
+	}
+	if !trustOpts.yes {
+		if !term.IsTerminal(os.Stdin.Fd()) {
+			return errors.New("trust reset needs confirmation, use -yes to reset without asking")
+		}
+		if !ask("Delete the cached trust data and fetch a new root?") {
+			return errors.New("trust reset cancelled")
+		}
+	}
+
+	entry := trustAudit{
+		Time:           time.Now().UTC(),
+		User:           currentUser(),
+		GUN:            cat.GUN,
+		Server:         cfg.Server,
+		Reason:         trustOpts.reason,
+		OldRootKeys:    old,
+		ForgotVersions: trustOpts.forgetVersions,
+	}
+	resetErr := cat.Reset(trustOpts.forgetVersions)
+	entry.NewRootKeys, _ = cat.RootKeyIDs()
+	entry.Result = "ok"
+	if resetErr != nil {
+		entry.Result = resetErr.Error()
+	}
+	if err := appendTrustLog(entry); err != nil {
+		if resetErr == nil {
+			resetErr = fmt.Errorf("recording trust reset: %v", err)
+		}
+	}
+	if resetErr != nil {
+		return resetErr
+	}
+	fmt.Printf("Root keys are now: %s\n", strings.Join(entry.NewRootKeys, ", "))
+	return nil
+}
+
+func appendTrustLog(entry trustAudit) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(baseDir(), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(trustLogFile(), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(b, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
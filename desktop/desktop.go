@@ -0,0 +1,244 @@
+// Package desktop parses, validates and writes freedesktop.org desktop
+// entries.
+package desktop
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/go-ini/ini"
+)
+
+// Group is the name of the main group of a desktop entry.
+const Group = "Desktop Entry"
+
+var (
+	keyPattern    = regexp.MustCompile(`^([A-Za-z0-9-]+)(\[[A-Za-z_@.]+\])?$`)
+	actionPattern = regexp.MustCompile(`^Desktop Action [A-Za-z0-9-]+$`)
+)
+
+// KeyValue is a single key of a desktop entry group.
+type KeyValue struct {
+	Key   string
+	Value string
+}
+
+// Entry is a parsed desktop entry. Values are kept escaped as they appear in
+// the file.
+type Entry struct {
+	Type       string
+	Name       string
+	Icon       string
+	Exec       string
+	Terminal   bool
+	MimeType   []string
+	Categories []string
+	// Extra holds every other key of the [Desktop Entry] group, in file
+	// order.
+	Extra []KeyValue
+	// Groups holds any further groups, such as desktop actions, in file
+	// order.
+	Groups []GroupKeys
+
+	// problems found while parsing, reported by Validate
+	problems []string
+}
+
+// GroupKeys is a group other than [Desktop Entry].
+type GroupKeys struct {
+	Name string
+	Keys []KeyValue
+}
+
+// Parse parses a desktop entry. Only syntax errors are returned; use
+// Validate to check the entry against the specification.
+func Parse(s string) (*Entry, error) {
+	quoted, groups, problems, err := quoteValues(s)
+	if err != nil {
+		return nil, err
+	}
+	f, err := ini.Load(quoted)
+	if err != nil {
+		return nil, err
+	}
+	main, err := f.GetSection(Group)
+	if err != nil {
+		return nil, fmt.Errorf("missing [%s] group", Group)
+	}
+	if len(groups) == 0 || groups[0] != Group {
+		problems = append(problems, fmt.Sprintf("[%s] must be the first group", Group))
+	}
+
+	e := &Entry{problems: problems}
+	for _, k := range main.Keys() {
+		val := k.Value()
+		switch k.Name() {
+		case "Type":
+			e.Type = val
+		case "Name":
+			e.Name = val
+		case "Icon":
+			e.Icon = val
+		case "Exec":
+			e.Exec = val
+		case "Terminal":
+			switch val {
+			case "true":
+				e.Terminal = true
+			case "false":
+			default:
+				e.problems = append(e.problems, fmt.Sprintf("Terminal: %q is not a boolean", val))
+			}
+		case "MimeType":
+			e.MimeType = splitList(val)
+		case "Categories":
+			e.Categories = splitList(val)
+		default:
+			e.Extra = append(e.Extra, KeyValue{Key: k.Name(), Value: val})
+		}
+	}
+	for _, name := range groups {
+		if name == Group {
+			continue
+		}
+		g := GroupKeys{Name: name}
+		for _, k := range f.Section(name).Keys() {
+			g.Keys = append(g.Keys, KeyValue{Key: k.Name(), Value: k.Value()})
+		}
+		e.Groups = append(e.Groups, g)
+	}
+	return e, nil
+}
+
+// quoteValues prepares a desktop entry for the ini parser, which would
+// otherwise treat the ';' separating list values as the start of a comment.
+// Every value is wrapped in the parser's literal quotes. It also returns the
+// groups in file order and reports duplicate or malformed keys, which the
+// ini parser silently accepts.
+func quoteValues(s string) ([]byte, []string, []string, error) {
+	var (
+		buf      bytes.Buffer
+		groups   []string
+		problems []string
+		seen     map[string]bool
+	)
+	for n, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || line[0] == '#':
+			continue
+		case line[0] == '[':
+			if !strings.HasSuffix(line, "]") {
+				return nil, nil, nil, fmt.Errorf("line %d: malformed group header %q", n+1, line)
+			}
+			name := line[1 : len(line)-1]
+			for _, g := range groups {
+				if g == name {
+					return nil, nil, nil, fmt.Errorf("line %d: duplicate group [%s]", n+1, name)
+				}
+			}
+			groups = append(groups, name)
+			seen = make(map[string]bool)
+			buf.WriteString(line + "\n")
+			continue
+		}
+
+		if len(groups) == 0 {
+			return nil, nil, nil, fmt.Errorf("line %d: key outside of a group", n+1)
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, nil, nil, fmt.Errorf("line %d: expected key=value, got %q", n+1, line)
+		}
+		key, val := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if !keyPattern.MatchString(key) {
+			return nil, nil, nil, fmt.Errorf("line %d: invalid key %q", n+1, key)
+		}
+		if seen[key] {
+			problems = append(problems, fmt.Sprintf("%s: set more than once", key))
+		}
+		seen[key] = true
+
+		switch {
+		case !strings.Contains(val, "`"):
+			fmt.Fprintf(&buf, "%s=`%s`\n", key, val)
+		case !strings.Contains(val, `"""`):
+			fmt.Fprintf(&buf, "%s=\"\"\"%s\"\"\"\n", key, val)
+		default:
+			return nil, nil, nil, fmt.Errorf("line %d: value of %s cannot be represented", n+1, key)
+		}
+	}
+	return buf.Bytes(), groups, problems, nil
+}
+
+// splitList splits a ';' separated list value, dropping the optional
+// trailing separator.
+func splitList(val string) []string {
+	val = strings.TrimSuffix(val, ";")
+	if val == "" {
+		return nil
+	}
+	return strings.Split(val, ";")
+}
+
+// String returns the entry as a desktop entry file, with keys in a canonical
+// order.
+func (e *Entry) String() string {
+	var buf bytes.Buffer
+	buf.WriteString("[" + Group + "]\n")
+	write := func(key, val string) {
+		if val != "" {
+			buf.WriteString(key + "=" + val + "\n")
+		}
+	}
+	write("Type", e.Type)
+	write("Name", e.Name)
+	write("Icon", e.Icon)
+	write("Exec", e.Exec)
+	write("Terminal", fmt.Sprint(e.Terminal))
+	if len(e.MimeType) > 0 {
+		write("MimeType", strings.Join(e.MimeType, ";")+";")
+	}
+	if len(e.Categories) > 0 {
+		write("Categories", strings.Join(e.Categories, ";")+";")
+	}
+	for _, kv := range e.Extra {
+		buf.WriteString(kv.Key + "=" + kv.Value + "\n")
+	}
+	for _, g := range e.Groups {
+		buf.WriteString("\n[" + g.Name + "]\n")
+		for _, kv := range g.Keys {
+			buf.WriteString(kv.Key + "=" + kv.Value + "\n")
+		}
+	}
+	return buf.String()
+}
+
+// Get returns the value of key in the [Desktop Entry] group, or the empty
+// string if it is not set.
+func (e *Entry) Get(key string) string {
+	switch key {
+	case "Type":
+		return e.Type
+	case "Name":
+		return e.Name
+	case "Icon":
+		return e.Icon
+	case "Exec":
+		return e.Exec
+	case "Terminal":
+		return fmt.Sprint(e.Terminal)
+	case "MimeType":
+		return strings.Join(e.MimeType, ";")
+	case "Categories":
+		return strings.Join(e.Categories, ";")
+	}
+	for _, kv := range e.Extra {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,225 @@
+package desktop
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/endophage/conman/atomicfile"
+)
+
+// Groups of a mimeapps.list file.
+const (
+	DefaultApplications = "Default Applications"
+	AddedAssociations   = "Added Associations"
+	RemovedAssociations = "Removed Associations"
+)
+
+// MimeApps is a parsed mimeapps.list file, which associates MIME types with
+// the desktop entries that open them. Comments and unrelated groups are
+// preserved when it is written back.
+type MimeApps struct {
+	groups []*mimeGroup
+}
+
+type mimeGroup struct {
+	name  string
+	lines []*mimeLine
+}
+
+// mimeLine is either a MIME type association or a line kept verbatim.
+type mimeLine struct {
+	mimeType string
+	ids      []string
+	raw      string
+}
+
+// LoadMimeApps reads the mimeapps.list file at path. A missing file is an
+// empty list.
+func LoadMimeApps(path string) (*MimeApps, error) {
+	m := &MimeApps{}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var g *mimeGroup
+	for _, line := range strings.Split(strings.TrimRight(string(b), "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			g = m.group(trimmed[1 : len(trimmed)-1])
+			continue
+		}
+		if g == nil {
+			g = m.group("")
+		}
+		parts := strings.SplitN(trimmed, "=", 2)
+		if len(parts) != 2 || strings.HasPrefix(trimmed, "#") || !isAssociationGroup(g.name) {
+			g.lines = append(g.lines, &mimeLine{raw: line})
+			continue
+		}
+		g.lines = append(g.lines, &mimeLine{
+			mimeType: strings.TrimSpace(parts[0]),
+			ids:      splitList(strings.TrimSpace(parts[1])),
+		})
+	}
+	return m, nil
+}
+
+// isAssociationGroup reports whether the named group lists associations.
+// Other groups are kept verbatim.
+func isAssociationGroup(name string) bool {
+	return name == DefaultApplications || name == AddedAssociations || name == RemovedAssociations
+}
+
+// find returns the named group, or nil if there is none.
+func (m *MimeApps) find(name string) *mimeGroup {
+	for _, g := range m.groups {
+		if g.name == name {
+			return g
+		}
+	}
+	return nil
+}
+
+// group returns the named group, creating it if needed.
+func (m *MimeApps) group(name string) *mimeGroup {
+	if g := m.find(name); g != nil {
+		return g
+	}
+	g := &mimeGroup{name: name}
+	m.groups = append(m.groups, g)
+	return g
+}
+
+func (g *mimeGroup) line(mimeType string) *mimeLine {
+	for _, l := range g.lines {
+		if l.mimeType == mimeType {
+			return l
+		}
+	}
+	l := &mimeLine{mimeType: mimeType}
+	g.lines = append(g.lines, l)
+	return l
+}
+
+// Default returns the desktop entry ID of the default application for
+// mimeType, or the empty string if there is none.
+func (m *MimeApps) Default(mimeType string) string {
+	g := m.find(DefaultApplications)
+	if g == nil {
+		return ""
+	}
+	for _, l := range g.lines {
+		if l.mimeType == mimeType && len(l.ids) > 0 {
+			return l.ids[0]
+		}
+	}
+	return ""
+}
+
+// SetDefault makes id the default application for mimeType, keeping the
+// previous defaults after it as fallbacks. An empty id clears the default.
+func (m *MimeApps) SetDefault(mimeType, id string) {
+	l := m.group(DefaultApplications).line(mimeType)
+	if id == "" {
+		l.ids = nil
+		return
+	}
+	l.ids = append([]string{id}, without(l.ids, id)...)
+}
+
+// Associate adds id as an application able to open mimeType, and drops it
+// from the removed associations of mimeType.
+func (m *MimeApps) Associate(mimeType, id string) {
+	if g := m.find(RemovedAssociations); g != nil {
+		for _, l := range g.lines {
+			if l.mimeType == mimeType {
+				l.ids = without(l.ids, id)
+			}
+		}
+	}
+	l := m.group(AddedAssociations).line(mimeType)
+	for _, existing := range l.ids {
+		if existing == id {
+			return
+		}
+	}
+	l.ids = append([]string{id}, l.ids...)
+}
+
+// Dissociate removes id from the associations and defaults of the given
+// MIME types, or of every MIME type if none are given.
+func (m *MimeApps) Dissociate(id string, mimeTypes ...string) {
+	match := func(mt string) bool {
+		if len(mimeTypes) == 0 {
+			return true
+		}
+		for _, t := range mimeTypes {
+			if t == mt {
+				return true
+			}
+		}
+		return false
+	}
+	for _, name := range []string{DefaultApplications, AddedAssociations} {
+		g := m.find(name)
+		if g == nil {
+			continue
+		}
+		for _, l := range g.lines {
+			if l.mimeType == "" || !match(l.mimeType) {
+				continue
+			}
+			l.ids = without(l.ids, id)
+		}
+	}
+}
+
+// without returns ids with every occurrence of id removed.
+func without(ids []string, id string) []string {
+	var out []string
+	for _, existing := range ids {
+		if existing != id {
+			out = append(out, existing)
+		}
+	}
+	return out
+}
+
+// Save atomically writes the list to path, as other applications share it.
+// Associations left with no applications are dropped.
+func (m *MimeApps) Save(path string) error {
+	var buf bytes.Buffer
+	for i, g := range m.groups {
+		var body bytes.Buffer
+		for _, l := range g.lines {
+			switch {
+			case l.mimeType == "":
+				body.WriteString(l.raw + "\n")
+			case len(l.ids) > 0:
+				body.WriteString(l.mimeType + "=" + strings.Join(l.ids, ";") + ";\n")
+			}
+		}
+		if g.name == "" {
+			buf.Write(body.Bytes())
+			continue
+		}
+		// groups are separated by a blank line, but follow the lines
+		// heading the file directly
+		if i > 0 && m.groups[i-1].name != "" && !bytes.HasSuffix(buf.Bytes(), []byte("\n\n")) {
+			buf.WriteString("\n")
+		}
+		buf.WriteString("[" + g.name + "]\n")
+		buf.Write(body.Bytes())
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(path, buf.Bytes(), 0644)
+}
@@ -0,0 +1,229 @@
+package desktop
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testMimeApps = `# kept as is
+[Default Applications]
+text/plain=gedit.desktop;vim.desktop;
+image/png = eog.desktop
+
+[Added Associations]
+text/plain=vim.desktop;
+not an association
+
+[Removed Associations]
+text/plain=atom.desktop;emacs.desktop;
+
+[X-Other]
+Key=Value
+`
+
+// loadMimeApps writes contents to a mimeapps.list in a new directory and
+// loads it. The directory must be removed by the caller.
+func loadMimeApps(t *testing.T, contents string) (*MimeApps, string) {
+	dir, err := ioutil.TempDir("", "mimeapps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "mimeapps.list")
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	m, err := LoadMimeApps(path)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return m, path
+}
+
+func (m *MimeApps) ids(group, mimeType string) []string {
+	g := m.find(group)
+	if g == nil {
+		return nil
+	}
+	for _, l := range g.lines {
+		if l.mimeType == mimeType {
+			return l.ids
+		}
+	}
+	return nil
+}
+
+func TestLoadMimeApps(t *testing.T) {
+	m, path := loadMimeApps(t, testMimeApps)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	for _, tt := range []struct {
+		group, mimeType string
+		ids             []string
+	}{
+		{DefaultApplications, "text/plain", []string{"gedit.desktop", "vim.desktop"}},
+		{DefaultApplications, "image/png", []string{"eog.desktop"}},
+		{AddedAssociations, "text/plain", []string{"vim.desktop"}},
+		{RemovedAssociations, "text/plain", []string{"atom.desktop", "emacs.desktop"}},
+		{AddedAssociations, "image/png", nil},
+	} {
+		if ids := m.ids(tt.group, tt.mimeType); !reflect.DeepEqual(ids, tt.ids) {
+			t.Errorf("[%s] %s = %v, want %v", tt.group, tt.mimeType, ids, tt.ids)
+		}
+	}
+	if d := m.Default("text/plain"); d != "gedit.desktop" {
+		t.Errorf("default for text/plain is %q", d)
+	}
+	if d := m.Default("text/html"); d != "" {
+		t.Errorf("default for text/html is %q", d)
+	}
+
+	m, err := LoadMimeApps(filepath.Join(filepath.Dir(path), "missing.list"))
+	if err != nil || len(m.groups) != 0 {
+		t.Errorf("loading a missing list: %v, %d groups", err, len(m.groups))
+	}
+}
+
+func TestAssociate(t *testing.T) {
+	m, path := loadMimeApps(t, testMimeApps)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	m.Associate("text/plain", "atom.desktop")
+	m.Associate("text/plain", "atom.desktop")
+	m.Associate("image/png", "atom.desktop")
+	for _, tt := range []struct {
+		group, mimeType string
+		ids             []string
+	}{
+		{AddedAssociations, "text/plain", []string{"atom.desktop", "vim.desktop"}},
+		{AddedAssociations, "image/png", []string{"atom.desktop"}},
+		{RemovedAssociations, "text/plain", []string{"emacs.desktop"}},
+		{DefaultApplications, "text/plain", []string{"gedit.desktop", "vim.desktop"}},
+	} {
+		if ids := m.ids(tt.group, tt.mimeType); !reflect.DeepEqual(ids, tt.ids) {
+			t.Errorf("after Associate: [%s] %s = %v, want %v", tt.group, tt.mimeType, ids, tt.ids)
+		}
+	}
+
+	m.SetDefault("text/plain", "atom.desktop")
+	m.Dissociate("atom.desktop", "text/plain")
+	for _, tt := range []struct {
+		group, mimeType string
+		ids             []string
+	}{
+		{AddedAssociations, "text/plain", []string{"vim.desktop"}},
+		{AddedAssociations, "image/png", []string{"atom.desktop"}},
+		{DefaultApplications, "text/plain", []string{"gedit.desktop", "vim.desktop"}},
+	} {
+		if ids := m.ids(tt.group, tt.mimeType); !reflect.DeepEqual(ids, tt.ids) {
+			t.Errorf("after Dissociate: [%s] %s = %v, want %v", tt.group, tt.mimeType, ids, tt.ids)
+		}
+	}
+
+	m.Dissociate("atom.desktop")
+	if ids := m.ids(AddedAssociations, "image/png"); len(ids) != 0 {
+		t.Errorf("dissociating every MIME type left image/png = %v", ids)
+	}
+}
+
+func TestSetDefault(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		mimeType string
+		id       string
+		ids      []string
+	}{
+		{"new default", "text/plain", "atom.desktop", []string{"atom.desktop", "gedit.desktop", "vim.desktop"}},
+		{"already a fallback", "text/plain", "vim.desktop", []string{"vim.desktop", "gedit.desktop"}},
+		{"already the default", "text/plain", "gedit.desktop", []string{"gedit.desktop", "vim.desktop"}},
+		{"no previous default", "text/html", "atom.desktop", []string{"atom.desktop"}},
+		{"cleared", "text/plain", "", nil},
+	} {
+		m, path := loadMimeApps(t, testMimeApps)
+		m.SetDefault(tt.mimeType, tt.id)
+		if ids := m.ids(DefaultApplications, tt.mimeType); !reflect.DeepEqual(ids, tt.ids) {
+			t.Errorf("%s: defaults for %s = %v, want %v", tt.name, tt.mimeType, ids, tt.ids)
+		}
+		os.RemoveAll(filepath.Dir(path))
+	}
+}
+
+func TestSaveMimeApps(t *testing.T) {
+	m, path := loadMimeApps(t, testMimeApps)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	// unchanged, the list is written back as it was read, apart from its
+	// associations being normalized
+	if err := m.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# kept as is
+[Default Applications]
+text/plain=gedit.desktop;vim.desktop;
+image/png=eog.desktop;
+
+[Added Associations]
+text/plain=vim.desktop;
+not an association
+
+[Removed Associations]
+text/plain=atom.desktop;emacs.desktop;
+
+[X-Other]
+Key=Value
+`
+	if string(b) != want {
+		t.Errorf("saved:\n%s\nwant:\n%s", b, want)
+	}
+
+	m.Associate("text/plain", "atom.desktop")
+	m.SetDefault("text/plain", "atom.desktop")
+	m.Dissociate("eog.desktop")
+	if err := m.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := LoadMimeApps(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		group, mimeType string
+		ids             []string
+	}{
+		{DefaultApplications, "text/plain", []string{"atom.desktop", "gedit.desktop", "vim.desktop"}},
+		{DefaultApplications, "image/png", nil},
+		{AddedAssociations, "text/plain", []string{"atom.desktop", "vim.desktop"}},
+		{RemovedAssociations, "text/plain", []string{"emacs.desktop"}},
+	} {
+		if ids := again.ids(tt.group, tt.mimeType); !reflect.DeepEqual(ids, tt.ids) {
+			t.Errorf("reloaded [%s] %s = %v, want %v", tt.group, tt.mimeType, ids, tt.ids)
+		}
+	}
+	if err := again.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(path); err != nil || string(b) != string(saved) {
+		t.Errorf("saving the reloaded list changed it: %v\n%s\n%s", err, saved, b)
+	}
+
+	// a list in a directory that does not exist yet is created
+	nested := filepath.Join(filepath.Dir(path), "config", "mimeapps.list")
+	if err := m.Save(nested); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(nested); err != nil || fi.Mode().Perm() != 0644 {
+		t.Errorf("saved list: %v, %v", fi, err)
+	}
+}
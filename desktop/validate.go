@@ -0,0 +1,99 @@
+package desktop
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// knownKeys are the keys the desktop entry specification defines for the
+// [Desktop Entry] group.
+var knownKeys = map[string]bool{
+	"Type":                 true,
+	"Version":              true,
+	"Name":                 true,
+	"GenericName":          true,
+	"NoDisplay":            true,
+	"Comment":              true,
+	"Icon":                 true,
+	"Hidden":               true,
+	"OnlyShowIn":           true,
+	"NotShowIn":            true,
+	"DBusActivatable":      true,
+	"TryExec":              true,
+	"Exec":                 true,
+	"Path":                 true,
+	"Terminal":             true,
+	"Actions":              true,
+	"MimeType":             true,
+	"Categories":           true,
+	"Implements":           true,
+	"Keywords":             true,
+	"StartupNotify":        true,
+	"StartupWMClass":       true,
+	"URL":                  true,
+	"PrefersNonDefaultGPU": true,
+	"SingleMainWindow":     true,
+}
+
+var (
+	mimeTypePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9!#$&^_.+-]*/[a-zA-Z0-9][a-zA-Z0-9!#$&^_.+-]*$`)
+	categoryPattern = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+)
+
+// ValidMimeType reports whether s is a "type/subtype" MIME type without
+// parameters.
+func ValidMimeType(s string) bool {
+	return mimeTypePattern.MatchString(s)
+}
+
+// Validate checks the entry against the desktop entry specification and
+// returns every problem found. It does not require Exec, which callers may
+// generate, and unlike the specification only accepts icon names for Icon.
+func (e *Entry) Validate() []string {
+	problems := append([]string(nil), e.problems...)
+	addf := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	switch e.Type {
+	case "":
+		addf("Type: must be set")
+	case "Application", "Link", "Directory":
+	default:
+		addf("Type: unknown type %q", e.Type)
+	}
+	if e.Name == "" {
+		addf("Name: must be set")
+	}
+	// icons are installed into the icon theme under their name, so paths
+	// are not accepted
+	if e.Icon != "" && (strings.Contains(e.Icon, "/") || strings.HasPrefix(e.Icon, ".")) {
+		addf("Icon: %q must be an icon name, not a path", e.Icon)
+	}
+	for _, mt := range e.MimeType {
+		if !ValidMimeType(mt) {
+			addf("MimeType: %q is not a valid MIME type", mt)
+		}
+	}
+	for _, c := range e.Categories {
+		if !categoryPattern.MatchString(c) {
+			addf("Categories: %q is not a valid category", c)
+		}
+	}
+	for _, kv := range e.Extra {
+		base := kv.Key
+		if i := strings.Index(base, "["); i >= 0 {
+			base = base[:i]
+		}
+		if !knownKeys[base] && !strings.HasPrefix(base, "X-") {
+			addf("%s: not a desktop entry key", kv.Key)
+		}
+	}
+	for _, g := range e.Groups {
+		if !actionPattern.MatchString(g.Name) && !strings.HasPrefix(g.Name, "X-") {
+			addf("[%s]: not a desktop entry group", g.Name)
+		}
+	}
+	return problems
+}
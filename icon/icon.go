@@ -0,0 +1,233 @@
+// Package icon downloads application icons, verifies them against the
+// digest pinned in the signed manifest, and caches them by content.
+package icon
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/endophage/conman/atomicfile"
+)
+
+// DefaultMaxSize is the largest icon that will be downloaded.
+const DefaultMaxSize int64 = 2 << 20
+
+// extensions maps the image types accepted as icons to file extensions.
+var extensions = map[string]string{
+	"image/png":     ".png",
+	"image/svg+xml": ".svg",
+	"image/jpeg":    ".jpg",
+	"image/gif":     ".gif",
+	"image/x-icon":  ".ico",
+}
+
+// ErrChecksumMismatch is returned when downloaded icon data does not match
+// the digest in the manifest.
+type ErrChecksumMismatch struct {
+	URL      string
+	Expected string
+	Actual   string
+}
+
+func (err ErrChecksumMismatch) Error() string {
+	return fmt.Sprintf("icon %s has sha256 %s, expected %s", err.URL, err.Actual, err.Expected)
+}
+
+// ErrTooLarge is returned when an icon exceeds the maximum download size.
+type ErrTooLarge struct {
+	URL string
+	Max int64
+}
+
+func (err ErrTooLarge) Error() string {
+	return fmt.Sprintf("icon %s is larger than %d bytes", err.URL, err.Max)
+}
+
+// ErrNotImage is returned when an icon is served as, or sniffed to be,
+// something other than a supported image type.
+type ErrNotImage struct {
+	URL         string
+	ContentType string
+}
+
+func (err ErrNotImage) Error() string {
+	return fmt.Sprintf("icon %s has unsupported content type %q", err.URL, err.ContentType)
+}
+
+// ErrNotCached is returned by offline fetchers for icons that are not in the
+// cache.
+type ErrNotCached struct {
+	URL string
+}
+
+func (err ErrNotCached) Error() string {
+	return fmt.Sprintf("icon %s is not cached and cannot be downloaded offline", err.URL)
+}
+
+// Icon is a verified icon in the cache.
+type Icon struct {
+	// Path is the location of the icon in the cache.
+	Path string
+	// Digest is the hex encoded sha256 of the icon.
+	Digest string
+	// Ext is the file extension matching the icon's image type.
+	Ext string
+}
+
+// Fetcher downloads icons into a content addressed cache.
+type Fetcher struct {
+	// Dir is the cache directory. Icons are stored as <sha256 hex><ext>.
+	Dir     string
+	Client  *http.Client
+	MaxSize int64
+	// Offline restricts the fetcher to icons already in the cache.
+	Offline bool
+}
+
+// NewFetcher returns a Fetcher caching icons in dir.
+func NewFetcher(dir string) *Fetcher {
+	return &Fetcher{Dir: dir, Client: http.DefaultClient, MaxSize: DefaultMaxSize}
+}
+
+// Fetch returns the cached icon with the given base64 encoded sha256
+// checksum, downloading it from url if it is not already cached. Nothing is
+// written to the cache until the download has been verified.
+func (f *Fetcher) Fetch(url, checksum string) (*Icon, error) {
+	want, err := decodeChecksum(checksum)
+	if err != nil {
+		return nil, err
+	}
+	if icon, err := f.Cached(checksum); err == nil {
+		return icon, nil
+	}
+	if f.Offline {
+		return nil, ErrNotCached{URL: url}
+	}
+
+	resp, err := f.Client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status fetching icon %s: %s", url, resp.Status)
+	}
+	if resp.ContentLength > f.MaxSize {
+		return nil, ErrTooLarge{URL: url, Max: f.MaxSize}
+	}
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, ErrNotImage{URL: url, ContentType: resp.Header.Get("Content-Type")}
+	}
+
+	var buf bytes.Buffer
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(&buf, h), io.LimitReader(resp.Body, f.MaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if n > f.MaxSize {
+		return nil, ErrTooLarge{URL: url, Max: f.MaxSize}
+	}
+	if got := h.Sum(nil); !bytes.Equal(got, want) {
+		return nil, ErrChecksumMismatch{
+			URL:      url,
+			Expected: checksum,
+			Actual:   base64.StdEncoding.EncodeToString(got),
+		}
+	}
+
+	ext, err := imageExt(mediaType, buf.Bytes())
+	if err != nil {
+		return nil, ErrNotImage{URL: url, ContentType: err.Error()}
+	}
+
+	icon := &Icon{Digest: hex.EncodeToString(want), Ext: ext}
+	icon.Path = filepath.Join(f.Dir, icon.Digest+ext)
+	if err := writeFile(icon.Path, buf.Bytes()); err != nil {
+		return nil, err
+	}
+	logrus.Debugf("cached icon %s as %s", url, icon.Path)
+	return icon, nil
+}
+
+// Cached returns the icon with the given base64 encoded sha256 checksum if
+// it is in the cache. Cached icons are re-verified, and evicted if they have
+// been corrupted.
+func (f *Fetcher) Cached(checksum string) (*Icon, error) {
+	want, err := decodeChecksum(checksum)
+	if err != nil {
+		return nil, err
+	}
+	digest := hex.EncodeToString(want)
+	matches, err := filepath.Glob(filepath.Join(f.Dir, digest+".*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range matches {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if got := sha256.Sum256(b); !bytes.Equal(got[:], want) {
+			logrus.Warnf("evicting corrupt cached icon %s", path)
+			os.Remove(path)
+			continue
+		}
+		return &Icon{Path: path, Digest: digest, Ext: filepath.Ext(path)}, nil
+	}
+	return nil, os.ErrNotExist
+}
+
+func decodeChecksum(checksum string) ([]byte, error) {
+	want, err := base64.StdEncoding.DecodeString(checksum)
+	if err != nil {
+		return nil, fmt.Errorf("invalid icon checksum %q: %v", checksum, err)
+	}
+	if len(want) != sha256.Size {
+		return nil, fmt.Errorf("invalid icon checksum %q: not a sha256 digest", checksum)
+	}
+	return want, nil
+}
+
+// imageExt checks that both the declared media type and the sniffed content
+// are a supported image type, and returns the matching file extension. SVG
+// cannot be sniffed, so it is accepted when declared and the content looks
+// like XML.
+func imageExt(mediaType string, b []byte) (string, error) {
+	ext, ok := extensions[mediaType]
+	if !ok {
+		return "", fmt.Errorf("%s", mediaType)
+	}
+	sniffed := http.DetectContentType(b)
+	if mediaType == "image/svg+xml" {
+		if !strings.HasPrefix(sniffed, "text/xml") && !strings.HasPrefix(sniffed, "text/plain") {
+			return "", fmt.Errorf("%s sniffed as %s", mediaType, sniffed)
+		}
+		return ext, nil
+	}
+	if _, ok := extensions[sniffed]; !ok {
+		return "", fmt.Errorf("%s sniffed as %s", mediaType, sniffed)
+	}
+	return extensions[sniffed], nil
+}
+
+// writeFile atomically writes b to name, creating the cache directory as
+// needed.
+func writeFile(name string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(name, b, 0644)
+}
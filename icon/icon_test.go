@@ -0,0 +1,236 @@
+package icon
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testPNG returns an encoded PNG and its base64 encoded sha256 checksum.
+func testPNG(t *testing.T) ([]byte, string) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 16, 16))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes(), checksumOf(buf.Bytes())
+}
+
+func checksumOf(b []byte) string {
+	sum := sha256.Sum256(b)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// iconServer serves body as contentType and counts the requests it gets.
+// A chunked body is sent without a Content-Length.
+type iconServer struct {
+	*httptest.Server
+	contentType string
+	body        []byte
+	chunked     bool
+	requests    int
+}
+
+func newIconServer(contentType string, body []byte) *iconServer {
+	s := &iconServer{contentType: contentType, body: body}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests++
+		w.Header().Set("Content-Type", s.contentType)
+		if s.chunked {
+			w.(http.Flusher).Flush()
+		}
+		w.Write(s.body)
+	}))
+	return s
+}
+
+// testFetcher returns a fetcher caching in a new directory, which must be
+// removed by the caller.
+func testFetcher(t *testing.T) *Fetcher {
+	dir, err := ioutil.TempDir("", "icons")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewFetcher(dir)
+}
+
+func TestFetch(t *testing.T) {
+	b, checksum := testPNG(t)
+	s := newIconServer("image/png", b)
+	defer s.Close()
+	f := testFetcher(t)
+	defer os.RemoveAll(f.Dir)
+
+	icon, err := f.Fetch(s.URL+"/atom.png", checksum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(b)
+	digest := hex.EncodeToString(sum[:])
+	if icon.Digest != digest || icon.Ext != ".png" || icon.Path != filepath.Join(f.Dir, digest+".png") {
+		t.Errorf("fetched %+v", icon)
+	}
+	if cached, err := ioutil.ReadFile(icon.Path); err != nil || !bytes.Equal(cached, b) {
+		t.Errorf("cached icon: %v", err)
+	}
+
+	// the icon is addressed by its digest, so any URL serving it hits the
+	// cache without downloading it again
+	again, err := f.Fetch(s.URL+"/elsewhere.png", checksum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *again != *icon || s.requests != 1 {
+		t.Errorf("second fetch got %+v after %d requests", again, s.requests)
+	}
+	f.Offline = true
+	if _, err := f.Fetch(s.URL+"/atom.png", checksum); err != nil {
+		t.Errorf("offline fetch of a cached icon: %v", err)
+	}
+	other := checksumOf(append(b, 0))
+	if _, err := f.Fetch(s.URL+"/other.png", other); err != (ErrNotCached{URL: s.URL + "/other.png"}) {
+		t.Errorf("offline fetch of an icon not cached = %v", err)
+	}
+	if s.requests != 1 {
+		t.Errorf("offline fetches made %d requests", s.requests-1)
+	}
+}
+
+func TestFetchInvalid(t *testing.T) {
+	b, checksum := testPNG(t)
+	for _, tt := range []struct {
+		name        string
+		contentType string
+		body        []byte
+		checksum    string
+		maxSize     int64
+		chunked     bool
+		check       func(error) bool
+	}{
+		{
+			name:        "checksum mismatch",
+			contentType: "image/png",
+			body:        append(b, 0),
+			checksum:    checksum,
+			check: func(err error) bool {
+				e, ok := err.(ErrChecksumMismatch)
+				return ok && e.Expected == checksum && e.Actual == checksumOf(append(b, 0))
+			},
+		},
+		{
+			name:        "oversize",
+			contentType: "image/png",
+			body:        b,
+			checksum:    checksum,
+			maxSize:     int64(len(b)) - 1,
+			check: func(err error) bool {
+				e, ok := err.(ErrTooLarge)
+				return ok && e.Max == int64(len(b))-1
+			},
+		},
+		{
+			name:        "oversize without a length",
+			contentType: "image/png",
+			body:        b,
+			checksum:    checksum,
+			maxSize:     int64(len(b)) - 1,
+			chunked:     true,
+			check: func(err error) bool {
+				e, ok := err.(ErrTooLarge)
+				return ok && e.Max == int64(len(b))-1
+			},
+		},
+		{
+			name:        "served as HTML",
+			contentType: "text/html",
+			body:        b,
+			checksum:    checksum,
+			check: func(err error) bool {
+				_, ok := err.(ErrNotImage)
+				return ok
+			},
+		},
+		{
+			name:        "HTML served as an image",
+			contentType: "image/png",
+			body:        []byte("<html><body>not an icon</body></html>"),
+			checksum:    checksumOf([]byte("<html><body>not an icon</body></html>")),
+			check: func(err error) bool {
+				_, ok := err.(ErrNotImage)
+				return ok
+			},
+		},
+		{
+			name:        "no content type",
+			contentType: "",
+			body:        b,
+			checksum:    checksum,
+			check: func(err error) bool {
+				_, ok := err.(ErrNotImage)
+				return ok
+			},
+		},
+		{
+			name:        "invalid checksum",
+			contentType: "image/png",
+			body:        b,
+			checksum:    "YhQp",
+			check:       func(err error) bool { return err != nil },
+		},
+	} {
+		s := newIconServer(tt.contentType, tt.body)
+		s.chunked = tt.chunked
+		f := testFetcher(t)
+		if tt.maxSize > 0 {
+			f.MaxSize = tt.maxSize
+		}
+		_, err := f.Fetch(s.URL+"/atom.png", tt.checksum)
+		if !tt.check(err) {
+			t.Errorf("%s: Fetch = %v", tt.name, err)
+		}
+		if files, _ := ioutil.ReadDir(f.Dir); len(files) != 0 {
+			t.Errorf("%s: rejected icon was cached", tt.name)
+		}
+		s.Close()
+		os.RemoveAll(f.Dir)
+	}
+}
+
+func TestCachedCorrupt(t *testing.T) {
+	b, checksum := testPNG(t)
+	s := newIconServer("image/png", b)
+	defer s.Close()
+	f := testFetcher(t)
+	defer os.RemoveAll(f.Dir)
+
+	icon, err := f.Fetch(s.URL+"/atom.png", checksum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(icon.Path, []byte("corrupt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Cached(checksum); !os.IsNotExist(err) {
+		t.Errorf("Cached returned a corrupt icon: %v", err)
+	}
+	if _, err := os.Stat(icon.Path); !os.IsNotExist(err) {
+		t.Errorf("corrupt icon was not evicted: %v", err)
+	}
+
+	// the next fetch downloads it again
+	again, err := f.Fetch(s.URL+"/atom.png", checksum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached, err := ioutil.ReadFile(again.Path); err != nil || !bytes.Equal(cached, b) || s.requests != 2 {
+		t.Errorf("refetched icon: %v after %d requests", err, s.requests)
+	}
+}
@@ -0,0 +1,157 @@
+package icon
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // register decoders for the raster icon types
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+)
+
+// ThemeSizes are the hicolor icon theme sizes raster icons are scaled to.
+var ThemeSizes = []int{16, 22, 24, 32, 48, 64, 96, 128, 256}
+
+// MaxDimension is the largest width or height of a raster icon that will be
+// decoded, and MaxPixels the largest number of pixels. A small compressed
+// file can otherwise declare an image large enough to exhaust memory when
+// decoded.
+const (
+	MaxDimension = 4096
+	MaxPixels    = 8 << 20
+)
+
+// Decode decodes the raster icon at path. Icons wider or taller than
+// MaxDimension, or with more than MaxPixels pixels, are refused before their
+// pixels are decoded.
+func Decode(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("decoding icon %s: %v", path, err)
+	}
+	if cfg.Width > MaxDimension || cfg.Height > MaxDimension {
+		return nil, fmt.Errorf("icon %s is %dx%d, larger than %dx%d", path, cfg.Width, cfg.Height, MaxDimension, MaxDimension)
+	}
+	if cfg.Width*cfg.Height > MaxPixels {
+		return nil, fmt.Errorf("icon %s is %dx%d, more than %d pixels", path, cfg.Width, cfg.Height, MaxPixels)
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("decoding icon %s: %v", path, err)
+	}
+	return img, nil
+}
+
+// Scale returns img scaled to fit a size by size square, keeping its aspect
+// ratio and centering it on a transparent background. Images are averaged
+// over each destination pixel when shrinking and interpolated bilinearly
+// when growing.
+func Scale(img image.Image, size int) *image.RGBA {
+	b := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+
+	sw, sh := b.Dx(), b.Dy()
+	w, h := size, size
+	switch {
+	case sw > sh:
+		h = max(1, size*sh/sw)
+	case sh > sw:
+		w = max(1, size*sw/sh)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	if sw == 0 || sh == 0 {
+		return dst
+	}
+	sample := bilinear
+	if sw >= w && sh >= h {
+		sample = boxAverage
+	}
+	ox, oy := (size-w)/2, (size-h)/2
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dst.SetRGBA(ox+x, oy+y, sample(src, x, y, w, h))
+		}
+	}
+	return dst
+}
+
+// boxAverage returns the average of the source pixels covered by
+// destination pixel (x, y) of a w by h image.
+func boxAverage(src *image.RGBA, x, y, w, h int) color.RGBA {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	x0, x1 := x*sw/w, max((x+1)*sw/w, x*sw/w+1)
+	y0, y1 := y*sh/h, max((y+1)*sh/h, y*sh/h+1)
+	var r, g, b, a, n uint32
+	for sy := y0; sy < y1; sy++ {
+		for sx := x0; sx < x1; sx++ {
+			c := src.RGBAAt(sx, sy)
+			r += uint32(c.R)
+			g += uint32(c.G)
+			b += uint32(c.B)
+			a += uint32(c.A)
+			n++
+		}
+	}
+	return color.RGBA{uint8(r / n), uint8(g / n), uint8(b / n), uint8(a / n)}
+}
+
+// bilinear interpolates the source pixels nearest to the center of
+// destination pixel (x, y) of a w by h image.
+func bilinear(src *image.RGBA, x, y, w, h int) color.RGBA {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	fx := clamp((float64(x)+0.5)*float64(sw)/float64(w)-0.5, float64(sw-1))
+	fy := clamp((float64(y)+0.5)*float64(sh)/float64(h)-0.5, float64(sh-1))
+	x0, y0 := int(fx), int(fy)
+	x1, y1 := min(x0+1, sw-1), min(y0+1, sh-1)
+	tx, ty := fx-float64(x0), fy-float64(y0)
+
+	c00, c10 := src.RGBAAt(x0, y0), src.RGBAAt(x1, y0)
+	c01, c11 := src.RGBAAt(x0, y1), src.RGBAAt(x1, y1)
+	lerp := func(a, b, c, d uint8) uint8 {
+		top := float64(a)*(1-tx) + float64(b)*tx
+		bottom := float64(c)*(1-tx) + float64(d)*tx
+		return uint8(top*(1-ty) + bottom*ty + 0.5)
+	}
+	return color.RGBA{
+		lerp(c00.R, c10.R, c01.R, c11.R),
+		lerp(c00.G, c10.G, c01.G, c11.G),
+		lerp(c00.B, c10.B, c01.B, c11.B),
+		lerp(c00.A, c10.A, c01.A, c11.A),
+	}
+}
+
+func clamp(v, hi float64) float64 {
+	if v < 0 {
+		return 0
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,56 @@
+package icon
+
+import (
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "icon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, tt := range []struct {
+		w, h int
+		err  string
+	}{
+		{48, 48, ""},
+		{MaxDimension, 1, ""},
+		{2048, 2048, ""},
+		{MaxDimension, MaxPixels / MaxDimension, ""},
+		{MaxDimension, MaxPixels/MaxDimension + 1, "more than"},
+		{MaxDimension + 1, 1, "larger than"},
+		{1, MaxDimension + 1, "larger than"},
+	} {
+		path := filepath.Join(dir, "icon.png")
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = png.Encode(f, image.NewGray(image.Rect(0, 0, tt.w, tt.h)))
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		img, err := Decode(path)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%dx%d: got error %v, want %q", tt.w, tt.h, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%dx%d: %v", tt.w, tt.h, err)
+		} else if b := img.Bounds(); b.Dx() != tt.w || b.Dy() != tt.h {
+			t.Errorf("%dx%d: decoded %v", tt.w, tt.h, b)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// Package install materializes applications from the conman catalog onto
+// the user's desktop.
+package install
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/endophage/conman/atomicfile"
+	"github.com/endophage/conman/catalog"
+	"github.com/endophage/conman/icon"
+	"github.com/endophage/conman/installdb"
+	"github.com/endophage/conman/manifest"
+	"github.com/endophage/conman/xdg"
+)
+
+// Installer writes desktop entries and icons for catalog applications.
+type Installer struct {
+	// DataHome is the XDG data directory files are installed under.
+	DataHome string
+	// ConfigHome is the XDG config directory holding mimeapps.list.
+	ConfigHome string
+	// Icons fetches and verifies icons.
+	Icons *icon.Fetcher
+	// Launcher is the conman binary installed desktop entries launch
+	// applications through.
+	Launcher string
+}
+
+// New returns an Installer targeting the user's XDG data directory.
+func New() (*Installer, error) {
+	dataHome, err := xdg.DataHome()
+	if err != nil {
+		return nil, err
+	}
+	configHome, err := xdg.ConfigHome()
+	if err != nil {
+		return nil, err
+	}
+	cacheHome, err := xdg.CacheHome()
+	if err != nil {
+		return nil, err
+	}
+	return &Installer{
+		DataHome:   dataHome,
+		ConfigHome: configHome,
+		Icons:      icon.NewFetcher(filepath.Join(cacheHome, "conman", "icons")),
+		Launcher:   launcher(),
+	}, nil
+}
+
+// launcher returns the absolute path of the running conman binary, falling
+// back to looking it up on $PATH at launch time.
+func launcher() string {
+	self, err := exec.LookPath(os.Args[0])
+	if err != nil {
+		return "conman"
+	}
+	if abs, err := filepath.Abs(self); err == nil {
+		return abs
+	}
+	return self
+}
+
+// DesktopFile returns the path of the desktop entry installed for the named
+// application.
+func (i *Installer) DesktopFile(name string) string {
+	return filepath.Join(i.DataHome, "applications", DesktopID(name))
+}
+
+// Install writes the desktop entry for app, downloads its icon and
+// associates it with the manifest's MIME types, as the default handler for
+// them if setDefault is true. It returns the record to keep for the app in
+// the install database.
+//
+// If the install fails, the files it created are removed again. Files it
+// overwrote belong to a previous install of the app and are left in place.
+func (i *Installer) Install(app *catalog.App, setDefault bool) (*installdb.Record, error) {
+	rec, err := newRecord(app)
+	if err != nil {
+		return nil, err
+	}
+	host, err := manifest.CurrentHost()
+	if err != nil {
+		return nil, err
+	}
+	// launch through conman so the image is verified and pinned each time
+	entry, err := app.Manifest.DesktopEntry(host, []string{i.Launcher, "run", app.Name})
+	if err != nil {
+		return nil, fmt.Errorf("generating desktop entry for %s: %v", app.Name, err)
+	}
+
+	var w writer
+	if err := i.installIcon(&w, app); err != nil {
+		i.rollback(&w)
+		return nil, fmt.Errorf("installing icon for %s: %v", app.Name, err)
+	}
+	desktopFile := i.DesktopFile(app.Name)
+	if err := w.writeFile(desktopFile, []byte(entry), 0644); err != nil {
+		i.rollback(&w)
+		return nil, fmt.Errorf("writing desktop entry for %s: %v", app.Name, err)
+	}
+	logrus.Debugf("wrote desktop entry %s", desktopFile)
+
+	replaced, err := i.registerMimeTypes(app.Name, app.Manifest.MimeTypes, setDefault)
+	if err != nil {
+		i.rollback(&w)
+		return nil, fmt.Errorf("registering MIME types for %s: %v", app.Name, err)
+	}
+	rec.Files = w.files
+	rec.MimeTypes = app.Manifest.MimeTypes
+	rec.DefaultHandler = setDefault
+	if len(replaced) > 0 {
+		rec.PreviousDefaults = replaced
+	}
+
+	return rec, nil
+}
+
+// writer records the files an install writes, and which of them it
+// created, so a failed install can be rolled back.
+type writer struct {
+	files   []string
+	created []string
+}
+
+// writeFile writes name like the package's writeFile and records it.
+func (w *writer) writeFile(name string, b []byte, perm os.FileMode) error {
+	_, err := os.Lstat(name)
+	created := os.IsNotExist(err)
+	if err := writeFile(name, b, perm); err != nil {
+		return err
+	}
+	w.files = append(w.files, name)
+	if created {
+		w.created = append(w.created, name)
+	}
+	return nil
+}
+
+// rollback removes the files created through w.
+func (i *Installer) rollback(w *writer) {
+	if len(w.created) == 0 {
+		return
+	}
+	for _, err := range removeFiles(w.created) {
+		logrus.Warnf("removing file of failed install: %v", err)
+	}
+	i.refreshIconTheme()
+}
+
+// writeFile atomically replaces the file at name with b, creating parent
+// directories as needed.
+func writeFile(name string, b []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(name, b, perm)
+}
@@ -0,0 +1,41 @@
+package install
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRollback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "install")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	i := &Installer{DataHome: dir}
+
+	old := filepath.Join(dir, "applications", "conman-atom.desktop")
+	if err := writeFile(old, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	created := filepath.Join(dir, "icons", "hicolor", "16x16", "apps", "atom.png")
+
+	var w writer
+	for _, f := range []string{old, created} {
+		if err := w.writeFile(f, []byte("new"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(w.files) != 2 || len(w.created) != 1 || w.created[0] != created {
+		t.Fatalf("wrote %v, created %v", w.files, w.created)
+	}
+	i.rollback(&w)
+
+	if _, err := os.Stat(created); !os.IsNotExist(err) {
+		t.Errorf("%s was not removed: %v", created, err)
+	}
+	if _, err := os.Stat(old); err != nil {
+		t.Errorf("%s of the previous install was removed: %v", old, err)
+	}
+}
@@ -0,0 +1,94 @@
+package install
+
+import (
+	"os/exec"
+	"path/filepath"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/endophage/conman/desktop"
+	"github.com/endophage/conman/installdb"
+)
+
+// DesktopID returns the desktop entry ID of the named application.
+func DesktopID(name string) string {
+	return "conman-" + name + ".desktop"
+}
+
+func (i *Installer) mimeAppsFile() string {
+	return filepath.Join(i.ConfigHome, "mimeapps.list")
+}
+
+// registerMimeTypes associates the application's desktop entry with each of
+// its MIME types in mimeapps.list, optionally as the default handler. It
+// returns the default applications it replaced.
+func (i *Installer) registerMimeTypes(name string, mimeTypes []string, setDefault bool) (map[string]string, error) {
+	if len(mimeTypes) == 0 {
+		return nil, nil
+	}
+	apps, err := desktop.LoadMimeApps(i.mimeAppsFile())
+	if err != nil {
+		return nil, err
+	}
+	id := DesktopID(name)
+	replaced := make(map[string]string)
+	for _, mt := range mimeTypes {
+		apps.Associate(mt, id)
+		if !setDefault {
+			continue
+		}
+		if prev := apps.Default(mt); prev != id {
+			if prev != "" {
+				replaced[mt] = prev
+			}
+			apps.SetDefault(mt, id)
+		}
+	}
+	if err := apps.Save(i.mimeAppsFile()); err != nil {
+		return nil, err
+	}
+	i.refreshMimeCache()
+	return replaced, nil
+}
+
+// unregisterMimeTypes removes the application's associations for the given
+// MIME types, or all of them if none are given, restoring any default
+// applications it replaced.
+func (i *Installer) unregisterMimeTypes(rec *installdb.Record, mimeTypes ...string) error {
+	if len(rec.MimeTypes) == 0 {
+		return nil
+	}
+	apps, err := desktop.LoadMimeApps(i.mimeAppsFile())
+	if err != nil {
+		return err
+	}
+	id := DesktopID(rec.Name)
+	if len(mimeTypes) == 0 {
+		mimeTypes = rec.MimeTypes
+	}
+	for _, mt := range mimeTypes {
+		wasDefault := apps.Default(mt) == id
+		apps.Dissociate(id, mt)
+		if prev := rec.PreviousDefaults[mt]; wasDefault && prev != "" {
+			apps.SetDefault(mt, prev)
+		}
+	}
+	if err := apps.Save(i.mimeAppsFile()); err != nil {
+		return err
+	}
+	i.refreshMimeCache()
+	return nil
+}
+
+// refreshMimeCache rebuilds the mimeinfo.cache for the installed desktop
+// entries, if update-desktop-database is available.
+func (i *Installer) refreshMimeCache() {
+	tool, err := exec.LookPath("update-desktop-database")
+	if err != nil {
+		logrus.Debug("update-desktop-database not found, not refreshing the MIME cache")
+		return
+	}
+	dir := filepath.Join(i.DataHome, "applications")
+	if out, err := exec.Command(tool, dir).CombinedOutput(); err != nil {
+		logrus.Warnf("refreshing MIME cache in %s: %v: %s", dir, err, out)
+	}
+}
@@ -0,0 +1,143 @@
+package install
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/endophage/conman/catalog"
+	"github.com/endophage/conman/installdb"
+)
+
+// newRecord returns an install database record for app with no files.
+func newRecord(app *catalog.App) (*installdb.Record, error) {
+	custom, err := app.Manifest.Custom()
+	if err != nil {
+		return nil, err
+	}
+	hash, err := app.Manifest.Digest()
+	if err != nil {
+		return nil, err
+	}
+	return &installdb.Record{
+		Name:         app.Name,
+		Role:         app.Role,
+		Digest:       hex.EncodeToString(app.Hashes["sha256"]),
+		ManifestHash: hash,
+		Manifest:     []byte(custom),
+		InstalledAt:  time.Now().UTC(),
+	}, nil
+}
+
+// Update brings an installed application up to date with its current
+// catalog target. Files are only rewritten when the manifest changed; an
+// image change alone just updates the record, as installed desktop entries
+// resolve the image at launch. Files from the previous install that are no
+// longer written are removed. The returned bool reports whether anything
+// changed.
+func (i *Installer) Update(prev *installdb.Record, app *catalog.App) (*installdb.Record, bool, error) {
+	hash, err := app.Manifest.Digest()
+	if err != nil {
+		return nil, false, err
+	}
+	digest := hex.EncodeToString(app.Hashes["sha256"])
+
+	if hash == prev.ManifestHash {
+		if digest == prev.Digest && app.Role == prev.Role {
+			return prev, false, nil
+		}
+		rec := *prev
+		rec.Digest = digest
+		rec.Role = app.Role
+		rec.InstalledAt = time.Now().UTC()
+		return &rec, true, nil
+	}
+
+	rec, err := i.Install(app, prev.DefaultHandler)
+	if err != nil {
+		return nil, false, err
+	}
+	i.RemoveStale(prev, rec)
+	return rec, true, nil
+}
+
+// RemoveStale deletes the files written by a previous install of an
+// application that its current install no longer writes, and drops MIME
+// associations it no longer declares. Defaults replaced by the previous
+// install carry over to the current record so they can still be restored.
+func (i *Installer) RemoveStale(prev, cur *installdb.Record) {
+	if files := stale(prev.Files, cur.Files); len(files) > 0 {
+		for _, err := range removeFiles(files) {
+			logrus.Warnf("removing stale file: %v", err)
+		}
+		i.refreshIconTheme()
+	}
+	if dropped := stale(prev.MimeTypes, cur.MimeTypes); len(dropped) > 0 {
+		if err := i.unregisterMimeTypes(prev, dropped...); err != nil {
+			logrus.Warnf("removing stale MIME associations: %v", err)
+		}
+	}
+	for mt, id := range prev.PreviousDefaults {
+		if !contains(cur.MimeTypes, mt) {
+			continue
+		}
+		if cur.PreviousDefaults == nil {
+			cur.PreviousDefaults = make(map[string]string)
+		}
+		cur.PreviousDefaults[mt] = id
+	}
+}
+
+// Remove deletes every file written for an installed application and
+// removes its MIME associations, restoring any defaults it replaced.
+func (i *Installer) Remove(rec *installdb.Record) error {
+	if err := i.unregisterMimeTypes(rec); err != nil {
+		return fmt.Errorf("removing MIME associations for %s: %v", rec.Name, err)
+	}
+	errs := removeFiles(rec.Files)
+	i.refreshIconTheme()
+	if len(errs) > 0 {
+		return fmt.Errorf("removing %s: %v", rec.Name, errs[0])
+	}
+	return nil
+}
+
+// removeFiles removes each file, ignoring those already gone, and returns
+// any errors encountered.
+func removeFiles(files []string) []error {
+	var errs []error
+	for _, f := range files {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+			continue
+		}
+		logrus.Debugf("removed %s", f)
+	}
+	return errs
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// stale returns the files in prev that are not in cur.
+func stale(prev, cur []string) []string {
+	keep := make(map[string]bool, len(cur))
+	for _, f := range cur {
+		keep[f] = true
+	}
+	var out []string
+	for _, f := range prev {
+		if !keep[f] {
+			out = append(out, f)
+		}
+	}
+	return out
+}
@@ -0,0 +1,134 @@
+package install
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/endophage/conman/catalog"
+	"github.com/endophage/conman/icon"
+	"github.com/endophage/conman/xdg"
+)
+
+// iconTheme is the theme icons are installed into. Every icon theme
+// inherits from it.
+const iconTheme = "hicolor"
+
+func (i *Installer) themeDir() string {
+	return filepath.Join(i.DataHome, "icons", iconTheme)
+}
+
+// installIcon fetches the verified application icon and installs it into
+// the hicolor theme, named after the desktop entry's Icon key so the desktop
+// can find it. Raster icons are scaled to each of icon.ThemeSizes, SVG icons
+// are installed as scalable. Icons that cannot be decoded are installed
+// unthemed in the base icon directory. The files are written through w.
+func (i *Installer) installIcon(w *writer, app *catalog.App) error {
+	ic, err := i.Icons.Fetch(app.Manifest.Icon.URL, app.Manifest.Icon.Checksum.SHA256)
+	if err != nil {
+		return err
+	}
+	name := app.Manifest.DesktopValue("Icon")
+	if name == "" {
+		name = app.Name
+	}
+
+	switch img, err := icon.Decode(ic.Path); {
+	case ic.Ext == ".svg":
+		file := filepath.Join(i.themeDir(), "scalable", "apps", name+ic.Ext)
+		if err := copyFile(w, file, ic.Path); err != nil {
+			return err
+		}
+		logrus.Debugf("wrote icon %s", file)
+	case err != nil:
+		logrus.Warnf("not adding icon for %s to the %s theme: %v", app.Name, iconTheme, err)
+		file := filepath.Join(i.DataHome, "icons", name+ic.Ext)
+		if err := copyFile(w, file, ic.Path); err != nil {
+			return err
+		}
+		logrus.Debugf("wrote icon %s", file)
+	default:
+		for _, size := range icon.ThemeSizes {
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, icon.Scale(img, size)); err != nil {
+				return err
+			}
+			dir := fmt.Sprintf("%dx%d", size, size)
+			file := filepath.Join(i.themeDir(), dir, "apps", name+".png")
+			if err := w.writeFile(file, buf.Bytes(), 0644); err != nil {
+				return err
+			}
+			logrus.Debugf("wrote icon %s", file)
+		}
+	}
+
+	i.refreshIconTheme()
+	return nil
+}
+
+func copyFile(w *writer, dst, src string) error {
+	b, err := ioutil.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return w.writeFile(dst, b, 0644)
+}
+
+// refreshIconTheme makes icon changes visible to the desktop. It writes a
+// hicolor index.theme if no data directory has one, bumps the theme
+// directory's modification time so stale caches are ignored, and rebuilds
+// the theme's icon cache if gtk-update-icon-cache is available.
+func (i *Installer) refreshIconTheme() {
+	dir := i.themeDir()
+	if !hasThemeIndex(append([]string{i.DataHome}, xdg.DataDirs()...)) {
+		if err := writeFile(filepath.Join(dir, "index.theme"), themeIndex(), 0644); err != nil {
+			logrus.Warnf("writing %s theme index: %v", iconTheme, err)
+		}
+	}
+	now := time.Now()
+	if err := os.Chtimes(dir, now, now); err != nil && !os.IsNotExist(err) {
+		logrus.Warnf("updating %s: %v", dir, err)
+	}
+
+	tool, err := exec.LookPath("gtk-update-icon-cache")
+	if err != nil {
+		logrus.Debug("gtk-update-icon-cache not found, not refreshing the icon cache")
+		return
+	}
+	if out, err := exec.Command(tool, "-q", "-f", "-t", dir).CombinedOutput(); err != nil {
+		logrus.Warnf("refreshing icon cache in %s: %v: %s", dir, err, out)
+	}
+}
+
+func hasThemeIndex(dataDirs []string) bool {
+	for _, d := range dataDirs {
+		if _, err := os.Stat(filepath.Join(d, "icons", iconTheme, "index.theme")); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// themeIndex returns a minimal hicolor index.theme covering the directories
+// conman installs into, for systems without the hicolor theme installed.
+func themeIndex() []byte {
+	var dirs, groups bytes.Buffer
+	for _, size := range icon.ThemeSizes {
+		dir := fmt.Sprintf("%dx%d/apps", size, size)
+		fmt.Fprintf(&dirs, "%s,", dir)
+		fmt.Fprintf(&groups, "\n[%s]\nSize=%d\nContext=Applications\nType=Threshold\n", dir, size)
+	}
+	dirs.WriteString("scalable/apps")
+	groups.WriteString("\n[scalable/apps]\nSize=128\nMinSize=1\nMaxSize=512\nContext=Applications\nType=Scalable\n")
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "[Icon Theme]\nName=Hicolor\nComment=Fallback icon theme\nHidden=true\nDirectories=%s\n", dirs.String())
+	buf.Write(groups.Bytes())
+	return buf.Bytes()
+}
@@ -0,0 +1,113 @@
+// Package installdb records the applications conman has installed and the
+// files it wrote for each, so they can be updated and cleanly removed.
+package installdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/endophage/conman/atomicfile"
+)
+
+// Record is what conman remembers about an installed application.
+type Record struct {
+	Name string `json:"name"`
+	// Role is the TUF role that signed the installed target.
+	Role string `json:"role"`
+	// Digest is the hex encoded sha256 of the image the target pinned.
+	Digest string `json:"digest"`
+	// ManifestHash is the hex encoded sha256 of the installed manifest.
+	ManifestHash string `json:"manifest_hash"`
+	// Manifest is the installed manifest.
+	Manifest json.RawMessage `json:"manifest"`
+	// Channel is the release channel the application was installed from,
+	// stable if empty.
+	Channel string `json:"channel,omitempty"`
+	// Files lists every file written for the application.
+	Files []string `json:"files"`
+	// MimeTypes lists the MIME types the application was registered for.
+	MimeTypes []string `json:"mimetypes,omitempty"`
+	// DefaultHandler is set if the application was made the default
+	// handler for its MIME types.
+	DefaultHandler bool `json:"default_handler,omitempty"`
+	// PreviousDefaults holds, by MIME type, the default applications that
+	// were replaced, so they can be restored on removal.
+	PreviousDefaults map[string]string `json:"previous_defaults,omitempty"`
+
+	InstalledAt time.Time `json:"installed_at"`
+}
+
+// DB is the set of installed applications, persisted as a JSON file.
+type DB struct {
+	path string
+	apps map[string]*Record
+}
+
+// Open loads the database at path. A missing file is an empty database.
+func Open(path string) (*DB, error) {
+	db := &DB{path: path, apps: make(map[string]*Record)}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return db, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var records []*Record
+	if err := json.Unmarshal(b, &records); err != nil {
+		return nil, fmt.Errorf("parsing install database %s: %v", path, err)
+	}
+	for _, r := range records {
+		db.apps[r.Name] = r
+	}
+	return db, nil
+}
+
+// Get returns the record for the named application, or nil if it is not
+// installed.
+func (db *DB) Get(name string) *Record {
+	return db.apps[name]
+}
+
+// Put adds or replaces the record for an application.
+func (db *DB) Put(r *Record) {
+	db.apps[r.Name] = r
+}
+
+// Delete forgets the named application.
+func (db *DB) Delete(name string) {
+	delete(db.apps, name)
+}
+
+// List returns every record, sorted by name.
+func (db *DB) List() []*Record {
+	records := make([]*Record, 0, len(db.apps))
+	for _, r := range db.apps {
+		records = append(records, r)
+	}
+	sort.Sort(byName(records))
+	return records
+}
+
+// Save atomically writes the database back to disk.
+func (db *DB) Save() error {
+	b, err := json.MarshalIndent(db.List(), "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(db.path), 0700); err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(db.path, append(b, '\n'), 0600)
+}
+
+type byName []*Record
+
+func (r byName) Len() int           { return len(r) }
+func (r byName) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r byName) Less(i, j int) bool { return r[i].Name < r[j].Name }
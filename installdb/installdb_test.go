@@ -0,0 +1,215 @@
+package installdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testRecord(name string) *Record {
+	return &Record{
+		Name:         name,
+		Role:         "targets/" + name,
+		Digest:       strings.Repeat("ab", 32),
+		ManifestHash: strings.Repeat("cd", 32),
+		Manifest:     json.RawMessage(`{"name":"` + name + `"}`),
+		Files:        []string{"/home/user/.local/share/applications/" + name + ".desktop"},
+		MimeTypes:    []string{"text/plain"},
+		PreviousDefaults: map[string]string{
+			"text/plain": "gedit.desktop",
+		},
+		InstalledAt: time.Date(2016, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+func testDB(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "installdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "conman", "installed.json"), func() { os.RemoveAll(dir) }
+}
+
+func names(records []*Record) []string {
+	var s []string
+	for _, r := range records {
+		s = append(s, r.Name)
+	}
+	return s
+}
+
+func TestOpenMissing(t *testing.T) {
+	path, cleanup := testDB(t)
+	defer cleanup()
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records := db.List(); len(records) != 0 {
+		t.Errorf("missing database lists %v", names(records))
+	}
+	if db.Get("atom") != nil {
+		t.Error("missing database has atom installed")
+	}
+}
+
+func TestPutGetDelete(t *testing.T) {
+	path, cleanup := testDB(t)
+	defer cleanup()
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Put(testRecord("vim"))
+	db.Put(testRecord("atom"))
+	if got, want := names(db.List()), []string{"atom", "vim"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("listed %v, want %v", got, want)
+	}
+
+	updated := testRecord("atom")
+	updated.Channel = "beta"
+	db.Put(updated)
+	if r := db.Get("atom"); r == nil || r.Channel != "beta" {
+		t.Errorf("Put did not replace atom: %+v", r)
+	}
+	if len(db.List()) != 2 {
+		t.Errorf("replacing atom listed %v", names(db.List()))
+	}
+
+	db.Delete("atom")
+	if db.Get("atom") != nil {
+		t.Error("atom is still installed after Delete")
+	}
+	db.Delete("missing")
+	if got, want := names(db.List()), []string{"vim"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("listed %v, want %v", got, want)
+	}
+}
+
+func TestSave(t *testing.T) {
+	path, cleanup := testDB(t)
+	defer cleanup()
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Put(testRecord("atom"))
+	db.Put(testRecord("vim"))
+	if err := db.Save(); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("mode %v, want 0600", fi.Mode())
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"atom", "vim"} {
+		got, want := reopened.Get(name), testRecord(name)
+		if got != nil {
+			// the manifest is reindented with the rest of the file
+			var buf bytes.Buffer
+			if err := json.Compact(&buf, got.Manifest); err != nil {
+				t.Fatal(err)
+			}
+			got.Manifest = buf.Bytes()
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("reopened %s as %+v, want %+v", name, got, want)
+		}
+	}
+
+	reopened.Delete("atom")
+	if err := reopened.Save(); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := names(db.List()), []string{"vim"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after removing atom listed %v, want %v", got, want)
+	}
+}
+
+// TestSaveCrash checks that a save interrupted before its rename leaves the
+// previous database intact.
+func TestSaveCrash(t *testing.T) {
+	path, cleanup := testDB(t)
+	defer cleanup()
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Put(testRecord("atom"))
+	if err := db.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a writer that died half way through its temporary file
+	db.Put(testRecord("vim"))
+	b, err := json.Marshal(db.List())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp.Write(b[:len(b)/2])
+	tmp.Close()
+
+	db, err = Open(path)
+	if err != nil {
+		t.Fatalf("opening after an interrupted save: %v", err)
+	}
+	if got, want := names(db.List()), []string{"atom"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after an interrupted save listed %v, want %v", got, want)
+	}
+
+	// the next save goes through despite the leftover
+	db.Put(testRecord("vim"))
+	if err := db.Save(); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := names(db.List()), []string{"atom", "vim"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("listed %v, want %v", got, want)
+	}
+}
+
+func TestOpenCorrupt(t *testing.T) {
+	path, cleanup := testDB(t)
+	defer cleanup()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(`[{"name":"atom"`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// a damaged database must not be mistaken for an empty one, whose
+	// next save would forget every installed application
+	if _, err := Open(path); err == nil || !strings.Contains(err.Error(), "parsing install database") {
+		t.Errorf("got error %v, want a parse error", err)
+	}
+}
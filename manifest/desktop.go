@@ -0,0 +1,70 @@
+package manifest
+
+import (
+	"regexp"
+
+	"github.com/endophage/conman/desktop"
+)
+
+// DesktopValue returns the value of key in the [Desktop Entry] group of the
+// manifest's desktop entry, or the empty string if it is not set.
+func (m *Manifest) DesktopValue(key string) string {
+	entry, err := desktop.Parse(m.Desktop)
+	if err != nil {
+		return ""
+	}
+	return entry.Get(key)
+}
+
+// DesktopEntry returns the canonical desktop entry to install for the
+// application in the given host session, with templates expanded. For
+// manifests with a Run, the Exec key is generated: it runs launcher when one
+// is given, and the docker command line otherwise. Legacy manifests keep
+// their raw Exec.
+func (m *Manifest) DesktopEntry(h *Host, launcher []string) (string, error) {
+	expanded, err := h.Expand(m.Desktop)
+	if err != nil {
+		return "", err
+	}
+	entry, err := desktop.Parse(expanded)
+	if err != nil {
+		return "", err
+	}
+	for _, mt := range m.MimeTypes {
+		if !contains(entry.MimeType, mt) {
+			entry.MimeType = append(entry.MimeType, mt)
+		}
+	}
+	if m.Run != nil {
+		entry.Exec = QuoteExec(launcher)
+		if len(launcher) == 0 {
+			if entry.Exec, err = m.Run.Exec(h); err != nil {
+				return "", err
+			}
+		}
+	}
+	return entry.String(), nil
+}
+
+// legacyMountPattern matches the host side of bind mounts in a raw docker
+// invocation.
+var legacyMountPattern = regexp.MustCompile(`(?:^|\s)(?:-v|--volume)[ =]"?([^:\s"]+):`)
+
+// legacyMountSources returns the host paths bind mounted by a raw docker
+// invocation in a desktop entry's Exec key.
+func legacyMountSources(exec string) []string {
+	var sources []string
+	for _, match := range legacyMountPattern.FindAllStringSubmatch(exec, -1) {
+		sources = append(sources, match[1])
+	}
+	return sources
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
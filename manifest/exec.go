@@ -0,0 +1,177 @@
+package manifest
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// SplitExec splits the value of a desktop entry's Exec key, escaped as it
+// appears in the desktop file, into arguments as described by the desktop
+// entry specification. Field codes such as %f are dropped.
+func SplitExec(value string) ([]string, error) {
+	s := unescapeString(value)
+	var (
+		args    []string
+		arg     bytes.Buffer
+		inArg   bool
+		inQuote bool
+	)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case inQuote && c == '\\' && i+1 < len(s) && strings.IndexByte("\"`$\\", s[i+1]) >= 0:
+			i++
+			arg.WriteByte(s[i])
+		case c == '"':
+			inQuote = !inQuote
+			inArg = true
+		case !inQuote && (c == ' ' || c == '\t'):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		case c == '%' && i+1 < len(s):
+			i++
+			if s[i] == '%' {
+				arg.WriteByte('%')
+			}
+			inArg = true
+		default:
+			arg.WriteByte(c)
+			inArg = true
+		}
+	}
+	if inQuote {
+		return nil, fmt.Errorf("unterminated quote in Exec %q", value)
+	}
+	if inArg && arg.Len() > 0 {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// unescapeString reverses the escapes allowed in desktop entry string values.
+func unescapeString(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 's':
+			b.WriteByte(' ')
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// splitShell splits a simple shell command line into words, handling quotes,
+// backslash escapes and variable references. Variables lookup does not know
+// are left as written. Anything beyond a single simple command is rejected,
+// as its effect cannot be determined without running it.
+func splitShell(s string, lookup func(string) (string, bool)) ([]string, error) {
+	var (
+		words  []string
+		word   bytes.Buffer
+		inWord bool
+		quote  byte
+	)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				word.WriteByte(c)
+			}
+		case c == '\\' && i+1 < len(s):
+			i++
+			if quote == '"' && strings.IndexByte("$`\"\\\n", s[i]) < 0 {
+				word.WriteByte('\\')
+			}
+			word.WriteByte(s[i])
+			inWord = true
+		case c == '$':
+			name, n := shellVariable(s[i+1:])
+			if name == "" {
+				if n < 0 {
+					return nil, fmt.Errorf("unsupported shell syntax in %q", s)
+				}
+				word.WriteByte(c)
+			} else if v, ok := lookup(name); ok {
+				word.WriteString(v)
+			} else {
+				word.WriteString(s[i : i+1+n])
+			}
+			i += n
+			inWord = true
+		case c == '`':
+			return nil, fmt.Errorf("unsupported shell syntax in %q", s)
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			} else {
+				word.WriteByte(c)
+			}
+		case c == '"' || c == '\'':
+			quote = c
+			inWord = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case strings.IndexByte(";&|<>()", c) >= 0:
+			return nil, fmt.Errorf("unsupported shell syntax in %q", s)
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in %q", s)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// shellVariable parses the variable reference following a $ at the start of
+// s, returning its name and the number of bytes it spans. A $ that does not
+// start a reference yields no name; one that starts a substitution or
+// expansion that cannot be followed yields a negative length.
+func shellVariable(s string) (string, int) {
+	if strings.HasPrefix(s, "{") {
+		end := strings.IndexByte(s, '}')
+		if end < 0 || !envNamePattern.MatchString(s[1:end]) {
+			return "", -1
+		}
+		return s[1:end], end + 1
+	}
+	if strings.HasPrefix(s, "(") {
+		return "", -1
+	}
+	n := 0
+	for n < len(s) && (s[n] == '_' || s[n] >= 'A' && s[n] <= 'Z' || s[n] >= 'a' && s[n] <= 'z' || n > 0 && s[n] >= '0' && s[n] <= '9') {
+		n++
+	}
+	return s[:n], n
+}
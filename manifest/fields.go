@@ -0,0 +1,98 @@
+package manifest
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// UnknownFieldError is returned when a manifest contains a field that is not
+// part of the manifest format.
+type UnknownFieldError struct {
+	Field string
+}
+
+func (err UnknownFieldError) Error() string {
+	return fmt.Sprintf("unknown manifest field %q", err.Field)
+}
+
+// checkFields walks a generically decoded JSON value alongside the Go type
+// it will be decoded into, and reports the first object key that has no
+// corresponding struct field.
+func checkFields(raw interface{}, v interface{}, path string) error {
+	return checkType(raw, reflect.TypeOf(v), path)
+}
+
+func checkType(raw interface{}, t reflect.Type, path string) error {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := raw.(map[string]interface{})
+		if !ok {
+			// type mismatches are reported by the real decode
+			return nil
+		}
+		fields := jsonFields(t)
+		for key, val := range obj {
+			field, ok := fields[key]
+			if !ok {
+				return UnknownFieldError{Field: joinPath(path, key)}
+			}
+			if err := checkType(val, field.Type, joinPath(path, key)); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		arr, ok := raw.([]interface{})
+		if !ok {
+			return nil
+		}
+		for i, val := range arr {
+			if err := checkType(val, t.Elem(), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		obj, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		for key, val := range obj {
+			if err := checkType(val, t.Elem(), joinPath(path, key)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// jsonFields maps the JSON object keys of a struct type to their fields.
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue // unexported
+		}
+		name := f.Name
+		if tag := f.Tag.Get("json"); tag != "" {
+			if tag == "-" {
+				continue
+			}
+			if n := strings.Split(tag, ",")[0]; n != "" {
+				name = n
+			}
+		}
+		fields[name] = f
+	}
+	return fields
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
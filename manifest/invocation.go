@@ -0,0 +1,358 @@
+package manifest
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Invocation is the docker run invocation launching an application, as far
+// as it matters for reviewing what the container can access on the host.
+type Invocation struct {
+	// Image is the image run.
+	Image string
+	// Mounts are the bind mounts of host paths, other than the X11 and
+	// PulseAudio sockets.
+	Mounts []Mount
+	// Devices are the host devices exposed to the container.
+	Devices []string
+	// Env are the environment settings, as NAME or NAME=value.
+	Env []string
+	// User is the user the container runs as, empty for the image default.
+	User string
+	// Network is the network mode, empty for the default bridge network.
+	Network string
+	// Privileged is set for --privileged containers.
+	Privileged bool
+	// Remove is set if the container is removed when it exits.
+	Remove bool
+	// CapAdd are the capabilities added to the container.
+	CapAdd []string
+	// X11 is set if the host X server socket is mounted.
+	X11 bool
+	// PulseAudio is set if the host PulseAudio socket is mounted.
+	PulseAudio bool
+	// Options are any other options given, as --name=value.
+	Options []string
+	// Args are the arguments following the image.
+	Args []string
+}
+
+// dockerRunShorthands maps the short docker run options to their long
+// names.
+var dockerRunShorthands = map[byte]string{
+	'a': "--attach",
+	'c': "--cpu-shares",
+	'd': "--detach",
+	'e': "--env",
+	'h': "--hostname",
+	'i': "--interactive",
+	'l': "--label",
+	'm': "--memory",
+	'P': "--publish-all",
+	'p': "--publish",
+	't': "--tty",
+	'u': "--user",
+	'v': "--volume",
+	'w': "--workdir",
+}
+
+// dockerRunValueOptions are the long docker run options taking a value.
+var dockerRunValueOptions = stringSet(`
+	--add-host --attach --blkio-weight --cap-add --cap-drop --cgroup-parent
+	--cidfile --cpu-period --cpu-quota --cpu-shares --cpus --cpuset-cpus
+	--cpuset-mems --device --device-cgroup-rule --dns --dns-option
+	--dns-search --domainname --entrypoint --env --env-file --expose --gpus
+	--group-add --health-cmd --health-interval --health-retries
+	--health-timeout --hostname --ip --ip6 --ipc --isolation --label
+	--label-file --link --log-driver --log-opt --mac-address --memory
+	--memory-reservation --memory-swap --mount --name --net --network
+	--network-alias --pid --pids-limit --platform --publish --pull --restart
+	--runtime --security-opt --shm-size --stop-signal --stop-timeout
+	--storage-opt --sysctl --tmpfs --ulimit --user --userns --uts --volume
+	--volume-driver --volumes-from --workdir
+`)
+
+// dockerRunBoolOptions are the long docker run options that are boolean.
+var dockerRunBoolOptions = stringSet(`
+	--detach --disable-content-trust --init --interactive --no-healthcheck
+	--oom-kill-disable --privileged --publish-all --quiet --read-only --rm
+	--sig-proxy --tty
+`)
+
+func stringSet(s string) map[string]bool {
+	set := make(map[string]bool)
+	for _, f := range strings.Fields(s) {
+		set[f] = true
+	}
+	return set
+}
+
+// ParseDockerRun parses a docker run command line launched in the given host
+// session. Options docker run does not know are refused rather than guessed
+// at, as guessing wrong whether they take a value would take the wrong
+// argument for the image.
+func ParseDockerRun(args []string, h *Host) (*Invocation, error) {
+	if len(args) < 2 || filepath.Base(args[0]) != "docker" || args[1] != "run" {
+		return nil, fmt.Errorf("not a docker run command: %q", strings.Join(args, " "))
+	}
+	inv := &Invocation{}
+	for i := 2; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			if i+1 < len(args) {
+				inv.setImage(args[i+1:])
+				return inv, nil
+			}
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			inv.setImage(args[i:])
+			return inv, nil
+		}
+
+		var (
+			opts []dockerOption
+			err  error
+		)
+		if strings.HasPrefix(arg, "--") {
+			opts, err = parseLongOption(arg)
+		} else {
+			opts, err = parseShortOptions(arg)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range opts {
+			if !dockerRunValueOptions[o.name] {
+				inv.setFlag(o.name, o.value, o.hasValue)
+				continue
+			}
+			if !o.hasValue {
+				if i+1 == len(args) {
+					return nil, fmt.Errorf("docker option %s needs a value", o.name)
+				}
+				i++
+				o.value = args[i]
+			}
+			if err := inv.setOption(o.name, o.value, h); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return nil, fmt.Errorf("no image in docker run command: %q", strings.Join(args, " "))
+}
+
+// setImage sets the image and the arguments following it.
+func (inv *Invocation) setImage(args []string) {
+	inv.Image = args[0]
+	if len(args) > 1 {
+		inv.Args = args[1:]
+	}
+}
+
+// dockerOption is a single option of a docker run command line, by its long
+// name.
+type dockerOption struct {
+	name     string
+	value    string
+	hasValue bool
+}
+
+// parseLongOption parses an option given as --name or --name=value.
+func parseLongOption(arg string) ([]dockerOption, error) {
+	o := dockerOption{name: arg}
+	if eq := strings.IndexByte(arg, '='); eq > 0 {
+		o.name, o.value, o.hasValue = arg[:eq], arg[eq+1:], true
+	}
+	if !dockerRunValueOptions[o.name] && !dockerRunBoolOptions[o.name] {
+		return nil, fmt.Errorf("unknown docker run option %s", o.name)
+	}
+	return []dockerOption{o}, nil
+}
+
+// parseShortOptions parses a group of short options, as in -it. An option
+// taking a value ends the group, its value being the rest of the argument,
+// as in -itv/src:/dst, or the next argument if nothing follows it.
+func parseShortOptions(arg string) ([]dockerOption, error) {
+	var opts []dockerOption
+	for j := 1; j < len(arg); j++ {
+		name, ok := dockerRunShorthands[arg[j]]
+		if !ok {
+			return nil, fmt.Errorf("unknown docker run option -%c in %s", arg[j], arg)
+		}
+		o := dockerOption{name: name}
+		if dockerRunValueOptions[name] {
+			if rest := arg[j+1:]; rest != "" {
+				o.value, o.hasValue = strings.TrimPrefix(rest, "="), true
+			}
+			return append(opts, o), nil
+		}
+		if j+1 < len(arg) && arg[j+1] == '=' {
+			o.value, o.hasValue = arg[j+2:], true
+			return append(opts, o), nil
+		}
+		opts = append(opts, o)
+	}
+	return opts, nil
+}
+
+func (inv *Invocation) setFlag(name, value string, hasValue bool) {
+	on := !hasValue || value == "true"
+	switch name {
+	case "--rm":
+		inv.Remove = on
+		return
+	case "--privileged":
+		inv.Privileged = on
+		return
+	case "--interactive", "--tty", "--detach":
+		// only affect how the container is attached
+		return
+	}
+	if hasValue {
+		name += "=" + value
+	}
+	inv.Options = append(inv.Options, name)
+}
+
+func (inv *Invocation) setOption(name, value string, h *Host) error {
+	switch name {
+	case "--volume":
+		parts := strings.Split(value, ":")
+		if len(parts) < 2 || !filepath.IsAbs(parts[0]) {
+			// anonymous and named volumes do not expose the host
+			return nil
+		}
+		readOnly := false
+		if len(parts) > 2 {
+			for _, opt := range strings.Split(parts[2], ",") {
+				if opt == "ro" {
+					readOnly = true
+				}
+			}
+		}
+		inv.bind(parts[0], parts[1], readOnly, h)
+	case "--mount":
+		return inv.setMount(value, h)
+	case "--device":
+		inv.Devices = append(inv.Devices, strings.SplitN(value, ":", 2)[0])
+	case "--env":
+		inv.Env = append(inv.Env, value)
+	case "--user":
+		inv.User = value
+	case "--net", "--network":
+		if value == "bridge" || value == "default" {
+			value = ""
+		}
+		inv.Network = value
+	case "--cap-add":
+		inv.CapAdd = append(inv.CapAdd, strings.ToUpper(strings.TrimPrefix(strings.ToUpper(value), "CAP_")))
+	case "--name", "--workdir", "--hostname", "--label", "--restart", "--log-driver", "--log-opt":
+		// harmless to the host
+	default:
+		inv.Options = append(inv.Options, name+"="+value)
+	}
+	return nil
+}
+
+// setMount parses a --mount option. Only bind mounts expose the host;
+// volume and tmpfs mounts are private to docker.
+func (inv *Invocation) setMount(value string, h *Host) error {
+	var typ, src, dst string
+	readOnly := false
+	for _, field := range strings.Split(value, ",") {
+		kv := strings.SplitN(field, "=", 2)
+		key, val := kv[0], ""
+		if len(kv) == 2 {
+			val = kv[1]
+		}
+		switch key {
+		case "type":
+			typ = val
+		case "source", "src":
+			src = val
+		case "target", "destination", "dst":
+			dst = val
+		case "readonly", "ro":
+			readOnly = len(kv) == 1 || val == "true" || val == "1"
+		}
+	}
+	switch typ {
+	case "bind":
+	case "", "volume", "tmpfs":
+		return nil
+	default:
+		return fmt.Errorf("unsupported mount type %q in --mount %s", typ, value)
+	}
+	if !filepath.IsAbs(src) {
+		return fmt.Errorf("bind mount source must be an absolute path in --mount %s", value)
+	}
+	inv.bind(src, dst, readOnly, h)
+	return nil
+}
+
+// bind records a bind mount of the host path src. The X11 and PulseAudio
+// sockets are recorded as such, any other path as a mount.
+func (inv *Invocation) bind(src, dst string, readOnly bool, h *Host) {
+	src = filepath.Clean(src)
+	switch {
+	case src == x11Socket:
+		inv.X11 = true
+	case h != nil && h.RuntimeDir != "" && src == pulseNative(h):
+		inv.PulseAudio = true
+	default:
+		inv.Mounts = append(inv.Mounts, Mount{Source: src, Target: dst, ReadOnly: readOnly})
+	}
+}
+
+// Invocation returns the docker invocation launching the application in the
+// given host session. It is generated from the manifest's Run, or for legacy
+// manifests parsed from the desktop entry's Exec key, which may wrap docker
+// in /bin/sh -c.
+func (m *Manifest) Invocation(h *Host) (*Invocation, error) {
+	if m.Run != nil {
+		args, err := m.Run.Args(h)
+		if err != nil {
+			return nil, err
+		}
+		return ParseDockerRun(args, h)
+	}
+
+	args, err := SplitExec(m.DesktopValue("Exec"))
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 3 && isShell(args[0]) && args[1] == "-c" {
+		if args, err = splitShell(args[2], h.lookupEnv); err != nil {
+			return nil, err
+		}
+	}
+	return ParseDockerRun(args, h)
+}
+
+func isShell(name string) bool {
+	switch filepath.Base(name) {
+	case "sh", "bash", "dash":
+		return true
+	}
+	return false
+}
+
+// lookupEnv resolves the environment variables legacy Exec lines rely on
+// from the host session.
+func (h *Host) lookupEnv(name string) (string, bool) {
+	switch name {
+	case "HOME":
+		return h.Home, true
+	case "UID":
+		return h.UID, true
+	case "USER":
+		return h.User, true
+	case "XDG_RUNTIME_DIR":
+		return h.RuntimeDir, true
+	case "DISPLAY":
+		return h.Display, true
+	}
+	return "", false
+}
@@ -0,0 +1,108 @@
+package manifest
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDockerRun(t *testing.T) {
+	for _, tt := range []struct {
+		cmd  string
+		want Invocation
+	}{
+		{"docker run --rm -it atom", Invocation{Image: "atom", Remove: true}},
+		{"docker run --rm=false -d atom --safe-mode", Invocation{Image: "atom", Args: []string{"--safe-mode"}}},
+		{"docker run -itv /etc:/etc atom", Invocation{
+			Image:  "atom",
+			Mounts: []Mount{{Source: "/etc", Target: "/etc"}},
+		}},
+		{"docker run -itv/etc:/etc:ro atom", Invocation{
+			Image:  "atom",
+			Mounts: []Mount{{Source: "/etc", Target: "/etc", ReadOnly: true}},
+		}},
+		{"docker run -e=DISPLAY -uatom atom", Invocation{Image: "atom", Env: []string{"DISPLAY"}, User: "atom"}},
+		{"docker run --runtime runc --privileged atom", Invocation{
+			Image:      "atom",
+			Privileged: true,
+			Options:    []string{"--runtime=runc"},
+		}},
+		{"docker run --mount type=bind,src=/etc,dst=/etc atom", Invocation{
+			Image:  "atom",
+			Mounts: []Mount{{Source: "/etc", Target: "/etc"}},
+		}},
+		{"docker run --mount=type=bind,source=/home/user/go,target=/go,readonly atom", Invocation{
+			Image:  "atom",
+			Mounts: []Mount{{Source: "/home/user/go", Target: "/go", ReadOnly: true}},
+		}},
+		{"docker run --mount type=volume,src=data,dst=/data atom", Invocation{Image: "atom"}},
+		{"docker run -v /tmp/.X11-unix:/tmp/.X11-unix -v /run/user/1000/pulse/native:/pulse atom", Invocation{
+			Image:      "atom",
+			X11:        true,
+			PulseAudio: true,
+		}},
+		{"docker run -v /home/user/pulse:/pulse -v /run/user/1000/pulse:/pulse atom", Invocation{
+			Image: "atom",
+			Mounts: []Mount{
+				{Source: "/home/user/pulse", Target: "/pulse"},
+				{Source: "/run/user/1000/pulse", Target: "/pulse"},
+			},
+		}},
+		{"docker run -v /etc/pulse/native:/pulse atom", Invocation{
+			Image:  "atom",
+			Mounts: []Mount{{Source: "/etc/pulse/native", Target: "/pulse"}},
+		}},
+		{"docker run -v data:/data -- atom -v /:/host", Invocation{Image: "atom", Args: []string{"-v", "/:/host"}}},
+	} {
+		got, err := ParseDockerRun(strings.Fields(tt.cmd), sampleHost)
+		if err != nil {
+			t.Errorf("%s: %v", tt.cmd, err)
+			continue
+		}
+		if !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("%s:\ngot  %+v\nwant %+v", tt.cmd, *got, tt.want)
+		}
+	}
+}
+
+func TestParseDockerRunInvalid(t *testing.T) {
+	for _, tt := range []struct {
+		cmd string
+		err string
+	}{
+		{"docker run --bogus runc --privileged -v /:/host --rm atom", "unknown docker run option --bogus"},
+		{"docker run -itx atom", "unknown docker run option -x"},
+		{"docker run --mount type=bind,src=etc,dst=/etc atom", "must be an absolute path"},
+		{"docker run --mount type=npipe,src=/etc,dst=/etc atom", "unsupported mount type"},
+		{"docker run --rm -v", "needs a value"},
+		{"docker run --rm", "no image"},
+		{"docker create atom", "not a docker run command"},
+	} {
+		_, err := ParseDockerRun(strings.Fields(tt.cmd), sampleHost)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, want %q", tt.cmd, err, tt.err)
+		}
+	}
+}
+
+func TestInvocation(t *testing.T) {
+	m, err := Parse([]byte(strings.Replace(testManifest, `"x11":true`, `"x11":true,"pulseaudio":true`, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inv, err := m.Invocation(sampleHost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Invocation{
+		Image:      "conman/apps:atom",
+		Mounts:     []Mount{{Source: "/home/user/go", Target: "/home/atom/go"}},
+		Env:        []string{"DISPLAY", "PULSE_SERVER=unix:/pulse"},
+		Remove:     true,
+		X11:        true,
+		PulseAudio: true,
+	}
+	if !reflect.DeepEqual(inv, want) {
+		t.Errorf("got  %+v\nwant %+v", inv, want)
+	}
+}
@@ -0,0 +1,135 @@
+// Package manifest defines the application descriptors that conman publishes
+// as custom metadata on the TUF targets of its catalog.
+package manifest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	cjson "github.com/docker/go/canonical/json"
+)
+
+// ErrNoManifest is returned when a target carries no custom metadata to
+// decode a manifest from.
+var ErrNoManifest = errors.New("target has no manifest in its custom metadata")
+
+// Manifest describes a single containerized desktop application.
+type Manifest struct {
+	// Desktop is the freedesktop.org desktop entry for the application.
+	Desktop string `json:"desktop"`
+	// Icon locates the application icon and pins its content.
+	Icon Icon `json:"icon"`
+	// MimeTypes lists the MIME types the application can open.
+	MimeTypes []string `json:"mimetypes"`
+	// Run describes the application's container. Manifests without one
+	// carry a raw docker invocation in the desktop entry's Exec key.
+	Run *Run `json:"run,omitempty"`
+}
+
+// Icon identifies the icon to download for an application.
+type Icon struct {
+	URL      string   `json:"url"`
+	Checksum Checksum `json:"checksum"`
+}
+
+// Checksum holds base64 encoded digests of a downloaded file.
+type Checksum struct {
+	SHA256 string `json:"sha256"`
+}
+
+// Parse decodes and validates a manifest. Fields that are not part of the
+// manifest format are rejected rather than silently ignored, so typos in
+// hand written manifests are caught early.
+func Parse(b []byte) (*Manifest, error) {
+	var raw interface{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("invalid manifest JSON: %v", err)
+	}
+	if err := checkFields(raw, Manifest{}, ""); err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{}
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %v", err)
+	}
+	if m.MimeTypes == nil {
+		m.MimeTypes = []string{}
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Decode reads a manifest from r and parses it.
+func Decode(r io.Reader) (*Manifest, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(b)
+}
+
+// Load reads and parses the manifest stored at path.
+func Load(path string) (*Manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m, err := Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return m, nil
+}
+
+// FromCustom parses the manifest carried in the Custom field of a TUF
+// target, as returned by the notary client. Notary's canonical encoder
+// writes the Custom field of a target as a base64 string rather than inline
+// JSON, so both forms are accepted.
+func FromCustom(custom []byte) (*Manifest, error) {
+	custom = bytes.TrimSpace(custom)
+	if len(custom) == 0 || bytes.Equal(custom, []byte("null")) {
+		return nil, ErrNoManifest
+	}
+	if custom[0] == '"' {
+		var raw []byte
+		if err := json.Unmarshal(custom, &raw); err != nil {
+			return nil, fmt.Errorf("decoding custom metadata: %v", err)
+		}
+		return FromCustom(raw)
+	}
+	return Parse(custom)
+}
+
+// Custom encodes the manifest as JSON suitable for passing to
+// NotaryRepository.AddTarget. Canonical encoding is deliberately not used
+// here as it leaves control characters such as the newlines in the desktop
+// entry unescaped, which standard JSON decoders reject.
+func (m *Manifest) Custom() (cjson.RawMessage, error) {
+	b, err := cjson.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return cjson.RawMessage(b), nil
+}
+
+// Digest returns the hex encoded sha256 of the manifest's encoding.
+func (m *Manifest) Digest() (string, error) {
+	custom, err := m.Custom()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(custom)
+	return hex.EncodeToString(sum[:]), nil
+}
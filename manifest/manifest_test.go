@@ -0,0 +1,180 @@
+package manifest
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testManifest = `{
+	"desktop":"[Desktop Entry]\nType=Application\nName=Atom\nIcon=atom\nTerminal=false",
+	"icon":{
+		"url":"https://example.com/atom.png",
+		"checksum":{"sha256":"YhQp8qbH2G7HhAHUtPMjxCrj0l7yFcUZ7VvQwSEtdEQ="}
+	},
+	"mimetypes":["text/plain"],
+	"run":{
+		"image":"conman/apps:atom",
+		"name":"atom",
+		"x11":true,
+		"mounts":[{"source":"{{home}}/go","target":"/home/atom/go"}]
+	}
+}`
+
+func TestRoundTrip(t *testing.T) {
+	m, err := Parse([]byte(testManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	custom, err := m.Custom()
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := FromCustom(custom)
+	if err != nil {
+		t.Fatalf("decoding %s: %v", custom, err)
+	}
+	if !reflect.DeepEqual(m, again) {
+		t.Errorf("round trip changed the manifest:\n%+v\n%+v", m, again)
+	}
+	d1, err := m.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d2, err := again.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d1 != d2 {
+		t.Errorf("digest changed in round trip: %s, %s", d1, d2)
+	}
+}
+
+func TestUnknownFields(t *testing.T) {
+	for _, tt := range []struct {
+		replace, with string
+		field         string
+	}{
+		{`"mimetypes"`, `"mimetype"`, "mimetype"},
+		{`"checksum":{"sha256"`, `"checksum":{"sha265"`, "icon.checksum.sha265"},
+		{`"x11":true`, `"x11":true,"privileged":true`, "run.privileged"},
+		{`"target":"/home/atom/go"`, `"target":"/home/atom/go","mode":"rw"`, "run.mounts[0].mode"},
+	} {
+		b := strings.Replace(testManifest, tt.replace, tt.with, 1)
+		_, err := Parse([]byte(b))
+		if err != (UnknownFieldError{Field: tt.field}) {
+			t.Errorf("%s: got error %v, want unknown field %s", tt.with, err, tt.field)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, tt := range []struct {
+		replace, with string
+		problem       string
+	}{
+		{`Icon=atom\n`, ``, "Icon must be set"},
+		{`Icon=atom`, `Icon=../../../../.bashrc`, "must be an icon name"},
+		{`Icon=atom`, `Icon=/usr/share/pixmaps/atom.png`, "must be an icon name"},
+		{`Icon=atom`, `Icon=.atom`, "must be an icon name"},
+		{`"https://example.com/atom.png"`, `"ftp://example.com/atom.png"`, "unsupported scheme"},
+		{`YhQp8qbH2G7HhAHUtPMjxCrj0l7yFcUZ7VvQwSEtdEQ=`, `YhQp`, "byte digest"},
+		{`"text/plain"`, `"text"`, "not a valid MIME type"},
+		{`{{home}}/go`, `/home/david/go`, "specific to one user"},
+		{`Terminal=false`, `Terminal=false\nExec=docker run atom`, "Exec must not be set"},
+		{`Terminal=false`, `Terminal=false\nTryExec=atom`, "TryExec must not be set"},
+		{`Terminal=false`, `Terminal=false\nActions=shell;\n\n[Desktop Action shell]\nName=Shell\nExec=docker run -v /:/host atom`, "[Desktop Action shell]: Exec must not be set"},
+		{`Terminal=false`, `Terminal=false\n\n[X-Extra]\nTryExec=sh`, "[X-Extra]: TryExec must not be set"},
+		{`Terminal=false`, `Terminal=false\nExec[de]=/bin/sh -c evil`, "Exec[de] must not be set"},
+		{`Terminal=false`, `Terminal=false\nTryExec[de]=x`, "TryExec[de] must not be set"},
+		{`Terminal=false`, `Terminal=false\nExecStart=sh`, "ExecStart must not be set"},
+		{`Terminal=false`, `Terminal=false\nActions=shell;\n\n[Desktop Action shell]\nName=Shell\nExec[de_DE@euro]=sh`, "[Desktop Action shell]: Exec[de_DE@euro] must not be set"},
+		{`Terminal=false`, `Terminal=false\n\n[X-Extra]\nTryExec[fr]=sh`, "[X-Extra]: TryExec[fr] must not be set"},
+	} {
+		b := strings.Replace(testManifest, tt.replace, tt.with, 1)
+		_, err := Parse([]byte(b))
+		if err == nil || !strings.Contains(err.Error(), tt.problem) {
+			t.Errorf("%s: got error %v, want %q", tt.with, err, tt.problem)
+		}
+	}
+}
+
+func TestCheckAppName(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		ok   bool
+	}{
+		{"atom", true},
+		{"spotify-beta", true},
+		{"gtk+3.20", true},
+		{"", false},
+		{"../x", false},
+		{"..", false},
+		{".atom", false},
+		{"-atom", false},
+		{"apps/atom", false},
+		{"atom app", false},
+	} {
+		if err := CheckAppName(tt.name); (err == nil) != tt.ok {
+			t.Errorf("CheckAppName(%q) = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestFromCustomBase64(t *testing.T) {
+	m, err := Parse([]byte(testManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	custom, err := m.Custom()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// as notary signs it: a RawMessage map value is not addressable, so
+	// its MarshalJSON is skipped and the bytes are encoded as base64
+	encoded, err := json.Marshal([]byte(custom))
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := FromCustom(encoded)
+	if err != nil {
+		t.Fatalf("decoding %s: %v", encoded, err)
+	}
+	if !reflect.DeepEqual(m, again) {
+		t.Errorf("decoding base64 changed the manifest:\n%+v\n%+v", m, again)
+	}
+	if _, err := FromCustom([]byte(`"not base64!"`)); err == nil {
+		t.Error("FromCustom accepted a string that is not base64")
+	}
+}
+
+func TestFromCustomEmpty(t *testing.T) {
+	for _, custom := range []string{"", " ", "null"} {
+		if _, err := FromCustom([]byte(custom)); err != ErrNoManifest {
+			t.Errorf("FromCustom(%q) = %v, want ErrNoManifest", custom, err)
+		}
+	}
+}
+
+func TestSetupManifests(t *testing.T) {
+	paths, err := filepath.Glob("../setup/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		if filepath.Base(path) == "base_custom.json" {
+			continue
+		}
+		m, err := Load(path)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		name := strings.TrimSuffix(filepath.Base(path), ".json")
+		if err := m.ValidateApp(name); err != nil {
+			t.Errorf("%s: %v", path, err)
+		}
+	}
+}
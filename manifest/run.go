@@ -0,0 +1,181 @@
+package manifest
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// x11Socket is the directory holding the X11 server sockets.
+	x11Socket = "/tmp/.X11-unix"
+	// pulseSocket is where the host PulseAudio socket is mounted in the
+	// container.
+	pulseSocket = "/pulse"
+)
+
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Run declaratively describes the container an application runs in. When a
+// manifest has a Run, conman generates the desktop entry's Exec line from it
+// instead of taking a hand written docker invocation.
+type Run struct {
+	// Image is the image reference to run, e.g. conman/apps:atom.
+	Image string `json:"image"`
+	// Name is the container name.
+	Name string `json:"name,omitempty"`
+	// Mounts are bind mounts from the host.
+	Mounts []Mount `json:"mounts,omitempty"`
+	// Devices are host devices exposed to the container.
+	Devices []string `json:"devices,omitempty"`
+	// Env sets environment variables in the container.
+	Env map[string]string `json:"env,omitempty"`
+	// User is the user, and optionally group, to run as.
+	User string `json:"user,omitempty"`
+	// X11 grants access to the host X server.
+	X11 bool `json:"x11,omitempty"`
+	// PulseAudio grants access to the host PulseAudio socket.
+	PulseAudio bool `json:"pulseaudio,omitempty"`
+}
+
+// Mount is a bind mount of a host path into the container.
+type Mount struct {
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	ReadOnly bool   `json:"readonly,omitempty"`
+}
+
+func (m Mount) String() string {
+	s := m.Source + ":" + m.Target
+	if m.ReadOnly {
+		s += ":ro"
+	}
+	return s
+}
+
+// Args returns the docker command line that launches the container in the
+// given host session.
+func (r *Run) Args(h *Host) ([]string, error) {
+	r, err := r.Expand(h)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"docker", "run", "--rm"}
+	if r.Name != "" {
+		args = append(args, "--name", r.Name)
+	}
+	if r.User != "" {
+		args = append(args, "--user", r.User)
+	}
+	if r.X11 {
+		args = append(args, "-v", x11Socket+":"+x11Socket, "-e", "DISPLAY")
+	}
+	if r.PulseAudio {
+		args = append(args,
+			"-v", pulseNative(h)+":"+pulseSocket,
+			"-e", "PULSE_SERVER=unix:"+pulseSocket,
+		)
+	}
+	for _, m := range r.Mounts {
+		args = append(args, "-v", m.String())
+	}
+	for _, d := range r.Devices {
+		args = append(args, "--device", d)
+	}
+	keys := make([]string, 0, len(r.Env))
+	for k := range r.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, "-e", k+"="+r.Env[k])
+	}
+	return append(args, r.Image), nil
+}
+
+// pulseNative returns the path of the host PulseAudio native socket.
+func pulseNative(h *Host) string {
+	return filepath.Join(h.RuntimeDir, "pulse", "native")
+}
+
+// Exec returns the Exec value for a desktop entry launching the container,
+// quoted as required by the desktop entry specification.
+func (r *Run) Exec(h *Host) (string, error) {
+	args, err := r.Args(h)
+	if err != nil {
+		return "", err
+	}
+	return QuoteExec(args), nil
+}
+
+// QuoteExec joins args into a desktop entry Exec value.
+func QuoteExec(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = quoteExecArg(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+func (r *Run) validate(addf func(string, ...interface{})) {
+	if r.Image == "" {
+		addf("run.image: must not be empty")
+	}
+	expand := func(field, s string) string {
+		v, err := sampleHost.Expand(s)
+		if err != nil {
+			addf("%s: %v", field, err)
+		}
+		return v
+	}
+
+	expand("run.user", r.User)
+	for i, m := range r.Mounts {
+		field := fmt.Sprintf("run.mounts[%d]", i)
+		if isPerUserPath(m.Source) {
+			addf("%s.source: %q is specific to one user, use a template such as {{home}} or {{runtime_dir}}", field, m.Source)
+		}
+		if src := expand(field+".source", m.Source); !filepath.IsAbs(src) {
+			addf("%s.source: %q must be an absolute path", field, m.Source)
+		}
+		if dst := expand(field+".target", m.Target); !filepath.IsAbs(dst) {
+			addf("%s.target: %q must be an absolute path", field, m.Target)
+		}
+	}
+	for i, d := range r.Devices {
+		field := fmt.Sprintf("run.devices[%d]", i)
+		if !strings.HasPrefix(expand(field, d), "/dev/") {
+			addf("%s: %q is not a device under /dev", field, d)
+		}
+	}
+	for k, v := range r.Env {
+		if !envNamePattern.MatchString(k) {
+			addf("run.env: %q is not a valid variable name", k)
+		}
+		expand("run.env."+k, v)
+	}
+}
+
+// quoteExecArg quotes an argument for the Exec key of a desktop entry. The
+// result is also escaped for use as a desktop entry string value.
+func quoteExecArg(arg string) string {
+	arg = strings.Replace(arg, "%", "%%", -1)
+	if arg != "" && !strings.ContainsAny(arg, " \t\n\"'\\><~|&;$*?#()`") {
+		return arg
+	}
+	var b bytes.Buffer
+	b.WriteByte('"')
+	for _, c := range arg {
+		switch c {
+		case '"', '`', '$', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	b.WriteByte('"')
+	// string values escape backslashes once more
+	return strings.Replace(b.String(), `\`, `\\`, -1)
+}
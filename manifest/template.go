@@ -0,0 +1,156 @@
+package manifest
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"regexp"
+	"strconv"
+
+	"github.com/endophage/conman/xdg"
+)
+
+// templatePattern matches a template reference such as {{home}}.
+var templatePattern = regexp.MustCompile(`\{\{\s*([a-z_]+)\s*\}\}`)
+
+// perUserPathPattern matches absolute host paths that only exist for one
+// particular user, and should be written with templates instead.
+var perUserPathPattern = regexp.MustCompile(`^(/home/[^/]+|/Users/[^/]+|/root|/run/user/[0-9]+)(/|$)`)
+
+// Host holds the values that manifest templates expand to for the user
+// session an application is installed or launched in.
+//
+// The template vocabulary is:
+//
+//	{{home}}             the user's home directory
+//	{{uid}}              the numeric user ID
+//	{{user}}             the user name
+//	{{runtime_dir}}      $XDG_RUNTIME_DIR
+//	{{display}}          the X11 display
+//	{{xdg_data_home}}    $XDG_DATA_HOME
+//	{{xdg_config_home}}  $XDG_CONFIG_HOME
+//	{{xdg_cache_home}}   $XDG_CACHE_HOME
+type Host struct {
+	Home       string
+	UID        string
+	User       string
+	RuntimeDir string
+	Display    string
+	DataHome   string
+	ConfigHome string
+	CacheHome  string
+}
+
+// sampleHost is used to validate templates without a real session.
+var sampleHost = &Host{
+	Home:       "/home/user",
+	UID:        "1000",
+	User:       "user",
+	RuntimeDir: "/run/user/1000",
+	Display:    ":0",
+	DataHome:   "/home/user/.local/share",
+	ConfigHome: "/home/user/.config",
+	CacheHome:  "/home/user/.cache",
+}
+
+// CurrentHost returns the template values for the current user session.
+func CurrentHost() (*Host, error) {
+	u, err := user.Current()
+	if err != nil {
+		return nil, err
+	}
+	h := &Host{
+		Home:       u.HomeDir,
+		UID:        u.Uid,
+		User:       u.Username,
+		RuntimeDir: os.Getenv("XDG_RUNTIME_DIR"),
+		Display:    os.Getenv("DISPLAY"),
+	}
+	if h.RuntimeDir == "" {
+		h.RuntimeDir = "/run/user/" + strconv.Itoa(os.Getuid())
+	}
+	if h.Display == "" {
+		h.Display = ":0"
+	}
+	if h.DataHome, err = xdg.DataHome(); err != nil {
+		return nil, err
+	}
+	if h.ConfigHome, err = xdg.ConfigHome(); err != nil {
+		return nil, err
+	}
+	if h.CacheHome, err = xdg.CacheHome(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *Host) lookup(name string) (string, bool) {
+	switch name {
+	case "home":
+		return h.Home, true
+	case "uid":
+		return h.UID, true
+	case "user":
+		return h.User, true
+	case "runtime_dir":
+		return h.RuntimeDir, true
+	case "display":
+		return h.Display, true
+	case "xdg_data_home":
+		return h.DataHome, true
+	case "xdg_config_home":
+		return h.ConfigHome, true
+	case "xdg_cache_home":
+		return h.CacheHome, true
+	}
+	return "", false
+}
+
+// Expand substitutes every template reference in s.
+func (h *Host) Expand(s string) (string, error) {
+	var err error
+	out := templatePattern.ReplaceAllStringFunc(s, func(ref string) string {
+		name := templatePattern.FindStringSubmatch(ref)[1]
+		val, ok := h.lookup(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("unknown template variable %q", name)
+		}
+		return val
+	})
+	return out, err
+}
+
+// Expand returns a copy of the run with every template reference
+// substituted.
+func (r *Run) Expand(h *Host) (*Run, error) {
+	out := *r
+	var err error
+	expand := func(s string) string {
+		v, e := h.Expand(s)
+		if e != nil && err == nil {
+			err = e
+		}
+		return v
+	}
+
+	out.User = expand(r.User)
+	out.Mounts = make([]Mount, len(r.Mounts))
+	for i, m := range r.Mounts {
+		out.Mounts[i] = Mount{Source: expand(m.Source), Target: expand(m.Target), ReadOnly: m.ReadOnly}
+	}
+	out.Devices = make([]string, len(r.Devices))
+	for i, d := range r.Devices {
+		out.Devices[i] = expand(d)
+	}
+	out.Env = make(map[string]string, len(r.Env))
+	for k, v := range r.Env {
+		out.Env[k] = expand(v)
+	}
+	return &out, err
+}
+
+// isPerUserPath reports whether path is an absolute path specific to one
+// user's session, such as /home/david or /run/user/1000.
+func isPerUserPath(path string) bool {
+	return perUserPathPattern.MatchString(path)
+}
@@ -0,0 +1,168 @@
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/endophage/conman/desktop"
+)
+
+// ValidationError lists every problem found in a manifest, so that authors
+// can fix them all in one pass.
+type ValidationError struct {
+	Problems []string
+}
+
+func (err ValidationError) Error() string {
+	return "invalid manifest: " + strings.Join(err.Problems, "; ")
+}
+
+// Validate checks the manifest for semantic problems that strict decoding
+// cannot catch.
+func (m *Manifest) Validate() error {
+	var problems []string
+	addf := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	var (
+		exec   string
+		groups []desktop.GroupKeys
+		extra  []desktop.KeyValue
+	)
+	if strings.TrimSpace(m.Desktop) == "" {
+		addf("desktop: must not be empty")
+	} else if entry, err := desktop.Parse(m.Desktop); err != nil {
+		addf("desktop: %v", err)
+	} else {
+		for _, p := range entry.Validate() {
+			addf("desktop: %s", p)
+		}
+		if entry.Type != "" && entry.Type != "Application" {
+			addf("desktop: Type must be Application")
+		}
+		if entry.Icon == "" {
+			addf("desktop: Icon must be set")
+		}
+		exec, groups, extra = entry.Exec, entry.Groups, entry.Extra
+	}
+
+	if m.Run != nil {
+		if exec != "" {
+			addf("desktop: Exec must not be set when run is given")
+		}
+		// conman only launches the container it generates Exec for, so no
+		// other command may be started from the entry, in any locale
+		for _, kv := range extra {
+			if key := unlocalized(kv.Key); strings.HasPrefix(key, "Exec") || key == "TryExec" {
+				addf("desktop: %s must not be set when run is given", kv.Key)
+			}
+		}
+		for _, g := range groups {
+			for _, kv := range g.Keys {
+				if key := unlocalized(kv.Key); key == "Exec" || key == "TryExec" {
+					addf("desktop: [%s]: %s must not be set when run is given", g.Name, kv.Key)
+				}
+			}
+		}
+		m.Run.validate(addf)
+	} else if exec == "" {
+		addf("desktop: Exec must be set when run is not given")
+	} else {
+		for _, src := range legacyMountSources(exec) {
+			if isPerUserPath(src) {
+				addf("desktop: Exec mounts %q which is specific to one user, use a template such as {{home}} or {{runtime_dir}}", src)
+			}
+		}
+	}
+	if _, err := sampleHost.Expand(m.Desktop); err != nil {
+		addf("desktop: %v", err)
+	}
+
+	if m.Icon.URL == "" {
+		addf("icon.url: must not be empty")
+	} else if u, err := url.Parse(m.Icon.URL); err != nil {
+		addf("icon.url: %v", err)
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		addf("icon.url: unsupported scheme %q", u.Scheme)
+	} else if u.Host == "" {
+		addf("icon.url: missing host")
+	}
+
+	if m.Icon.Checksum.SHA256 == "" {
+		addf("icon.checksum.sha256: must not be empty")
+	} else if d, err := base64.StdEncoding.DecodeString(m.Icon.Checksum.SHA256); err != nil {
+		addf("icon.checksum.sha256: not valid base64: %v", err)
+	} else if len(d) != sha256.Size {
+		addf("icon.checksum.sha256: expected %d byte digest, got %d", sha256.Size, len(d))
+	}
+
+	seen := make(map[string]bool)
+	for _, mt := range m.MimeTypes {
+		if !desktop.ValidMimeType(mt) {
+			addf("mimetypes: %q is not a valid MIME type", mt)
+		}
+		if seen[mt] {
+			addf("mimetypes: %q listed more than once", mt)
+		}
+		seen[mt] = true
+	}
+
+	if len(problems) > 0 {
+		return ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// appNamePattern matches valid app names. Names become file names and
+// desktop entry IDs, so they must not hold path separators or start with a
+// dot.
+var appNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+-]*$`)
+
+// CheckAppName returns an error if name is not a valid app name.
+func CheckAppName(name string) error {
+	if !appNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid app name %q: it must start with a letter or digit and contain only letters, digits and ._+-", name)
+	}
+	return nil
+}
+
+// nonAlphanumeric matches the characters ignored when comparing an app's
+// name with its desktop entry Name.
+var nonAlphanumeric = regexp.MustCompile(`[^a-z0-9]+`)
+
+// ValidateApp validates the manifest as published for the named app. On top
+// of Validate, it requires the desktop entry's Name to match the app, so a
+// manifest cannot masquerade as a different application.
+func (m *Manifest) ValidateApp(name string) error {
+	if err := CheckAppName(name); err != nil {
+		return err
+	}
+	var problems []string
+	if err := m.Validate(); err != nil {
+		problems = append(problems, err.(ValidationError).Problems...)
+	}
+	title := m.DesktopValue("Name")
+	normalize := func(s string) string {
+		return nonAlphanumeric.ReplaceAllString(strings.ToLower(s), "")
+	}
+	if title != "" && normalize(title) != normalize(name) {
+		problems = append(problems, fmt.Sprintf("desktop: Name %q does not match app %q", title, name))
+	}
+	if len(problems) > 0 {
+		return ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// unlocalized returns a desktop entry key without its [locale] suffix.
+func unlocalized(key string) string {
+	if i := strings.IndexByte(key, '['); i >= 0 {
+		return key[:i]
+	}
+	return key
+}
@@ -0,0 +1,214 @@
+// Package passphrase supplies the passphrases of notary signing keys
+// without asking, for publishing from CI, falling back to notary's prompt
+// on a terminal.
+package passphrase
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/docker/pkg/term"
+	notarypass "github.com/docker/notary/passphrase"
+	"github.com/docker/notary/tuf/data"
+)
+
+// Delegation is the role name passphrases for every delegation role are
+// given under, unless the delegation has its own.
+const Delegation = "delegation"
+
+// Source supplies passphrases for keys by role.
+type Source interface {
+	// Passphrase returns the passphrase for keys of role, if the source has
+	// one.
+	Passphrase(role string) (string, bool)
+}
+
+// Passphrases is a Source of fixed passphrases by role. Delegation roles
+// without a passphrase of their own use the one for Delegation.
+type Passphrases map[string]string
+
+// Passphrase implements Source.
+func (p Passphrases) Passphrase(role string) (string, bool) {
+	if pass, ok := p[role]; ok {
+		return pass, true
+	}
+	if data.IsDelegation(role) {
+		pass, ok := p[Delegation]
+		return pass, ok
+	}
+	return "", false
+}
+
+// envSource reads passphrases from CONMAN_<ROLE>_PASSPHRASE variables.
+type envSource struct{}
+
+// Env returns a Source reading the passphrase for each role from the
+// environment, as for notary: CONMAN_ROOT_PASSPHRASE,
+// CONMAN_TARGETS_PASSPHRASE, CONMAN_SNAPSHOT_PASSPHRASE and
+// CONMAN_DELEGATION_PASSPHRASE. A delegation may have its own, such as
+// CONMAN_TARGETS_BETA_PASSPHRASE for targets/beta.
+func Env() Source {
+	return envSource{}
+}
+
+func (envSource) Passphrase(role string) (string, bool) {
+	if pass, ok := os.LookupEnv(envVar(role)); ok {
+		return pass, true
+	}
+	if data.IsDelegation(role) {
+		return os.LookupEnv(envVar(Delegation))
+	}
+	return "", false
+}
+
+// envVar returns the environment variable holding the passphrase for role.
+func envVar(role string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, role)
+	return "CONMAN_" + name + "_PASSPHRASE"
+}
+
+// File returns the passphrases in the file at path, which other users must
+// not be able to access. The file holds a role=passphrase line for each
+// role, where the role is root, targets, snapshot, timestamp, delegation or
+// the name of a delegation role. Blank lines and lines starting with # are
+// ignored.
+func File(path string) (Passphrases, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, fmt.Errorf("passphrase file %s is not a regular file", path)
+	}
+	if perm := fi.Mode().Perm(); perm&0077 != 0 {
+		return nil, fmt.Errorf("passphrase file %s is accessible by other users (mode %04o), it must be 0600", path, perm)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p, err := Parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("passphrase file %s: %v", path, err)
+	}
+	return p, nil
+}
+
+// FD returns the passphrases read from the open file descriptor fd, in the
+// format of File. The descriptor is read to the end and closed.
+func FD(fd uintptr) (Passphrases, error) {
+	f := os.NewFile(fd, fmt.Sprintf("fd %d", fd))
+	if f == nil {
+		return nil, fmt.Errorf("invalid passphrase file descriptor %d", fd)
+	}
+	defer f.Close()
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading passphrases from fd %d: %v", fd, err)
+	}
+	p, err := Parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("passphrases from fd %d: %v", fd, err)
+	}
+	return p, nil
+}
+
+// Parse parses passphrases in the format of File.
+func Parse(b []byte) (Passphrases, error) {
+	p := make(Passphrases)
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSuffix(s.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.Index(line, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("line %d: expected role=passphrase", n)
+		}
+		role := strings.TrimSpace(line[:i])
+		if !validRole(role) {
+			return nil, fmt.Errorf("line %d: unknown role %q", n, role)
+		}
+		if _, ok := p[role]; ok {
+			return nil, fmt.Errorf("line %d: duplicate passphrase for %s", n, role)
+		}
+		// the passphrase is taken verbatim, spaces and all
+		p[role] = line[i+1:]
+	}
+	return p, s.Err()
+}
+
+func validRole(role string) bool {
+	switch role {
+	case data.CanonicalRootRole, data.CanonicalTargetsRole, data.CanonicalSnapshotRole, data.CanonicalTimestampRole, Delegation:
+		return true
+	}
+	return data.IsDelegation(role)
+}
+
+// ErrNoPassphrase is logged when no source has a passphrase for a key and
+// there is no terminal to ask on.
+type ErrNoPassphrase struct {
+	Role string
+	// Tried is the number of passphrases tried, all of which were wrong.
+	Tried int
+}
+
+func (err ErrNoPassphrase) Error() string {
+	if err.Tried > 0 {
+		return fmt.Sprintf("the configured passphrase for the %s key is wrong", err.Role)
+	}
+	return fmt.Sprintf("no passphrase for the %s key: set %s or run on a terminal", err.Role, envVar(err.Role))
+}
+
+// Retriever returns a notary passphrase retriever that tries the passphrase
+// each source has for a key's role in turn, one per attempt, and then asks
+// on the terminal with notary's prompt. Without a terminal on standard
+// input it gives up instead.
+func Retriever(sources ...Source) notarypass.Retriever {
+	var prompt notarypass.Retriever
+	if term.IsTerminal(os.Stdin.Fd()) {
+		prompt = notarypass.PromptRetriever()
+	}
+	return chain(sources, prompt)
+}
+
+func chain(sources []Source, prompt notarypass.Retriever) notarypass.Retriever {
+	return func(keyName, alias string, createNew bool, attempts int) (string, bool, error) {
+		// keys being imported are asked for as "imported <role>"
+		role := strings.TrimPrefix(alias, "imported ")
+		var candidates []string
+		seen := make(map[string]bool)
+		for _, s := range sources {
+			if pass, ok := s.Passphrase(role); ok && !seen[pass] {
+				seen[pass] = true
+				candidates = append(candidates, pass)
+			}
+		}
+		if attempts < len(candidates) {
+			return candidates[attempts], false, nil
+		}
+		if prompt != nil {
+			return prompt(keyName, alias, createNew, attempts-len(candidates))
+		}
+		// The key stores report any giving up as a wrong passphrase, and
+		// retry new keys forever on an error, so give up without one and
+		// log the reason.
+		logrus.Error(ErrNoPassphrase{Role: role, Tried: len(candidates)})
+		return "", true, nil
+	}
+}
@@ -0,0 +1,218 @@
+package passphrase
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestEnv(t *testing.T) {
+	for name, value := range map[string]string{
+		"CONMAN_TARGETS_PASSPHRASE":      "targets pass",
+		"CONMAN_DELEGATION_PASSPHRASE":   "delegation pass",
+		"CONMAN_TARGETS_BETA_PASSPHRASE": "beta pass",
+		"CONMAN_SNAPSHOT_PASSPHRASE":     "",
+	} {
+		os.Setenv(name, value)
+		defer os.Unsetenv(name)
+	}
+	os.Unsetenv("CONMAN_ROOT_PASSPHRASE")
+
+	for _, tt := range []struct {
+		role, pass string
+		ok         bool
+	}{
+		{"targets", "targets pass", true},
+		{"targets/beta", "beta pass", true},
+		{"targets/acme", "delegation pass", true},
+		{"snapshot", "", true},
+		{"root", "", false},
+	} {
+		pass, ok := Env().Passphrase(tt.role)
+		if pass != tt.pass || ok != tt.ok {
+			t.Errorf("Env().Passphrase(%s) = %q, %v, want %q, %v", tt.role, pass, ok, tt.pass, tt.ok)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	p, err := Parse([]byte("# CI keys\n\nroot=r00t\ntargets = with spaces \r\ndelegation=d=e\ntargets/beta=beta\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Passphrases{"root": "r00t", "targets": " with spaces ", "delegation": "d=e", "targets/beta": "beta"}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("parsed %q, want %q", p, want)
+	}
+	for _, tt := range []struct {
+		role, pass string
+		ok         bool
+	}{
+		{"targets/beta", "beta", true},
+		{"targets/acme", "d=e", true},
+		{"snapshot", "", false},
+	} {
+		if pass, ok := p.Passphrase(tt.role); pass != tt.pass || ok != tt.ok {
+			t.Errorf("Passphrase(%s) = %q, %v, want %q, %v", tt.role, pass, ok, tt.pass, tt.ok)
+		}
+	}
+
+	for _, tt := range []struct {
+		in, err string
+	}{
+		{"root\n", "line 1: expected role=passphrase"},
+		{"\nadmin=x\n", "line 2: unknown role"},
+		{"root=a\nroot=b\n", "line 2: duplicate passphrase for root"},
+	} {
+		if _, err := Parse([]byte(tt.in)); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Parse(%q) = %v, want %q", tt.in, err, tt.err)
+		}
+	}
+}
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "passphrases")
+
+	for _, tt := range []struct {
+		mode os.FileMode
+		err  string
+	}{
+		{0600, ""},
+		{0400, ""},
+		{0640, "accessible by other users (mode 0640)"},
+		{0604, "accessible by other users (mode 0604)"},
+		{0644, "accessible by other users (mode 0644)"},
+	} {
+		if err := ioutil.WriteFile(path, []byte("targets=t\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(path, tt.mode); err != nil {
+			t.Fatal(err)
+		}
+		p, err := File(path)
+		if tt.err == "" {
+			if err != nil || p["targets"] != "t" {
+				t.Errorf("mode %04o: File = %v, %v", tt.mode, p, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("mode %04o: File = %v, want %q", tt.mode, err, tt.err)
+		}
+		os.Remove(path)
+	}
+
+	if _, err := File(dir); err == nil || !strings.Contains(err.Error(), "not a regular file") {
+		t.Errorf("File of a directory = %v", err)
+	}
+	if _, err := File(path); !os.IsNotExist(err) {
+		t.Errorf("File of a missing file = %v", err)
+	}
+	if err := ioutil.WriteFile(path, []byte("nope\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := File(path); err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("File with a bad line = %v", err)
+	}
+}
+
+func TestFD(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// FD closes the descriptor it is given, which r must not close again
+	fd, err := syscall.Dup(int(r.Fd()))
+	r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.WriteString("targets=from fd\n"); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	p, err := FD(uintptr(fd))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p["targets"] != "from fd" {
+		t.Errorf("read %q from fd", p)
+	}
+}
+
+// prompt records the attempts it is asked for.
+type prompt struct {
+	attempts []int
+}
+
+func (p *prompt) retrieve(keyName, alias string, createNew bool, attempts int) (string, bool, error) {
+	p.attempts = append(p.attempts, attempts)
+	return "prompted", false, nil
+}
+
+func TestRetriever(t *testing.T) {
+	// as configured: environment, then file descriptor, then file
+	sources := []Source{
+		Passphrases{"targets": "env"},
+		Passphrases{"targets": "fd", "delegation": "shared", "root": "fd root"},
+		Passphrases{"targets": "env", "delegation": "file", "root": "file root"},
+	}
+	for _, tt := range []struct {
+		alias   string
+		tries   []string
+		prompts []int
+	}{
+		// each source in order, once per passphrase, then the prompt
+		{"targets", []string{"env", "fd", "prompted", "prompted"}, []int{0, 1}},
+		{"imported root", []string{"fd root", "file root", "prompted"}, []int{0}},
+		{"targets/beta", []string{"shared", "file", "prompted"}, []int{0}},
+		{"snapshot", []string{"prompted"}, []int{0}},
+	} {
+		p := &prompt{}
+		retrieve := chain(sources, p.retrieve)
+		for attempts, want := range tt.tries {
+			pass, giveUp, err := retrieve("0123", tt.alias, false, attempts)
+			if pass != want || giveUp || err != nil {
+				t.Errorf("%s attempt %d: %q, %v, %v, want %q", tt.alias, attempts, pass, giveUp, err, want)
+			}
+		}
+		if !reflect.DeepEqual(p.attempts, tt.prompts) {
+			t.Errorf("%s: prompted for attempts %v, want %v", tt.alias, p.attempts, tt.prompts)
+		}
+	}
+}
+
+func TestRetrieverGivesUp(t *testing.T) {
+	retrieve := chain([]Source{Passphrases{"targets": "wrong"}}, nil)
+	if pass, giveUp, err := retrieve("0123", "targets", false, 0); pass != "wrong" || giveUp || err != nil {
+		t.Errorf("first attempt: %q, %v, %v", pass, giveUp, err)
+	}
+	for _, tt := range []struct {
+		alias    string
+		attempts int
+	}{
+		{"targets", 1},
+		{"targets", 5},
+		{"root", 0},
+	} {
+		if pass, giveUp, err := retrieve("0123", tt.alias, true, tt.attempts); pass != "" || !giveUp || err != nil {
+			t.Errorf("%s attempt %d without a terminal: %q, %v, %v, want to give up", tt.alias, tt.attempts, pass, giveUp, err)
+		}
+	}
+}
+
+func TestErrNoPassphrase(t *testing.T) {
+	if msg := (ErrNoPassphrase{Role: "targets/beta"}).Error(); !strings.Contains(msg, "CONMAN_TARGETS_BETA_PASSPHRASE") {
+		t.Errorf("no passphrase: %s", msg)
+	}
+	if msg := (ErrNoPassphrase{Role: "root", Tried: 2}).Error(); !strings.Contains(msg, "wrong") {
+		t.Errorf("wrong passphrase: %s", msg)
+	}
+}
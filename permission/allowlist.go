@@ -0,0 +1,95 @@
+package permission
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/endophage/conman/manifest"
+)
+
+// Allowlist grants permissions without asking the user, for non-interactive
+// installs. Entries are permission IDs, and may use manifest templates such
+// as {{home}} and path.Match patterns:
+//
+//	{
+//		"allow":["x11","pulseaudio","network","mount:/etc/localtime:ro"],
+//		"apps":{
+//			"cheese":["device:/dev/video*","mount:{{home}}/Pictures/*:rw"]
+//		}
+//	}
+//
+// Allowing a read-write mount also allows mounting the same path read-only.
+type Allowlist struct {
+	// Allow lists the permissions granted to every application.
+	Allow []string `json:"allow"`
+	// Apps lists further permissions granted to individual applications.
+	Apps map[string][]string `json:"apps"`
+}
+
+// LoadAllowlist reads the allowlist at path, expanding templates for the
+// given host session.
+func LoadAllowlist(path string, h *manifest.Host) (*Allowlist, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	a := &Allowlist{}
+	if err := json.NewDecoder(f).Decode(a); err != nil {
+		return nil, fmt.Errorf("parsing allowlist %s: %v", path, err)
+	}
+	expand := func(patterns []string) error {
+		for i, p := range patterns {
+			if patterns[i], err = h.Expand(p); err != nil {
+				return fmt.Errorf("allowlist %s: %v", path, err)
+			}
+		}
+		return nil
+	}
+	if err := expand(a.Allow); err != nil {
+		return nil, err
+	}
+	for _, patterns := range a.Apps {
+		if err := expand(patterns); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// Allows reports whether the allowlist grants p to the named application.
+// A nil Allowlist grants nothing.
+func (a *Allowlist) Allows(app string, p Permission) bool {
+	if a == nil {
+		return false
+	}
+	ids := []string{p.ID}
+	if rw := readWriteVariant(p.ID); rw != "" {
+		ids = append(ids, rw)
+	}
+	for _, patterns := range [][]string{a.Allow, a.Apps[app]} {
+		for _, pattern := range patterns {
+			for _, id := range ids {
+				if ok, _ := path.Match(pattern, id); ok {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// Unapproved returns the permissions in perms the allowlist does not grant to
+// the named application.
+func (a *Allowlist) Unapproved(app string, perms []Permission) []Permission {
+	var out []Permission
+	for _, p := range perms {
+		if !a.Allows(app, p) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
@@ -0,0 +1,102 @@
+package permission
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/endophage/conman/manifest"
+)
+
+const testAllowlist = `{
+	"allow":["x11","network","mount:/etc/localtime:ro","mount:{{home}}/Music:rw"],
+	"apps":{
+		"cheese":["device:/dev/video*","mount:{{home}}/Pictures/*:rw"]
+	}
+}`
+
+func TestAllows(t *testing.T) {
+	dir, err := ioutil.TempDir("", "allowlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "allowlist.json")
+	if err := ioutil.WriteFile(path, []byte(testAllowlist), 0644); err != nil {
+		t.Fatal(err)
+	}
+	a, err := LoadAllowlist(path, &manifest.Host{Home: "/home/user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		app, id string
+		allowed bool
+	}{
+		{"atom", "x11", true},
+		{"atom", "network", true},
+		{"atom", "network:host", false},
+		{"atom", "pulseaudio", false},
+		{"atom", "mount:/etc/localtime:ro", true},
+		{"atom", "mount:/etc/localtime:rw", false},
+		// a read-write grant covers read-only, templates are expanded
+		{"atom", "mount:/home/user/Music:rw", true},
+		{"atom", "mount:/home/user/Music:ro", true},
+		{"atom", "mount:{{home}}/Music:rw", false},
+		// app grants only apply to that app
+		{"cheese", "device:/dev/video0", true},
+		{"atom", "device:/dev/video0", false},
+		{"cheese", "device:/dev/snd", false},
+		{"cheese", "x11", true},
+		// patterns do not cross path separators
+		{"cheese", "mount:/home/user/Pictures/2016:rw", true},
+		{"cheese", "mount:/home/user/Pictures/2016:ro", true},
+		{"cheese", "mount:/home/user/Pictures/2016/05:rw", false},
+		{"cheese", "mount:/home/user/Pictures:rw", false},
+	} {
+		if got := a.Allows(tt.app, Permission{ID: tt.id}); got != tt.allowed {
+			t.Errorf("Allows(%s, %s) = %v, want %v", tt.app, tt.id, got, tt.allowed)
+		}
+	}
+
+	perms := []Permission{{ID: "x11"}, {ID: "pulseaudio"}, {ID: "device:/dev/video0"}}
+	if got := IDs(a.Unapproved("atom", perms)); len(got) != 2 || got[0] != "pulseaudio" || got[1] != "device:/dev/video0" {
+		t.Errorf("unapproved for atom: %v", got)
+	}
+	if got := IDs(a.Unapproved("cheese", perms)); len(got) != 1 || got[0] != "pulseaudio" {
+		t.Errorf("unapproved for cheese: %v", got)
+	}
+}
+
+func TestNilAllowlist(t *testing.T) {
+	var a *Allowlist
+	if a.Allows("atom", Permission{ID: "x11"}) {
+		t.Error("nil allowlist allows x11")
+	}
+	if got := a.Unapproved("atom", []Permission{{ID: "x11"}}); len(got) != 1 {
+		t.Errorf("nil allowlist approved %v", got)
+	}
+}
+
+func TestLoadAllowlistInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "allowlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, contents := range []string{
+		`{"allow":["x11"`,
+		`{"allow":["mount:{{nope}}/x:rw"]}`,
+		`{"apps":{"atom":["mount:{{nope}}/x:rw"]}}`,
+	} {
+		path := filepath.Join(dir, "allowlist.json")
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadAllowlist(path, &manifest.Host{Home: "/home/user"}); err == nil {
+			t.Errorf("loaded invalid allowlist %s", contents)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package permission
+
+import "strings"
+
+// Escalations returns the permissions in cur that prev does not grant,
+// described as changes, such as "now mounts /home/user read-write" or
+// "new device /dev/snd". A read-only mount is covered by a read-write mount
+// of the same path, but not the other way around.
+func Escalations(prev, cur []Permission) []Permission {
+	had := make(map[string]bool, len(prev))
+	for _, p := range prev {
+		had[p.ID] = true
+	}
+	var out []Permission
+	for _, p := range cur {
+		if had[p.ID] || had[readWriteVariant(p.ID)] {
+			continue
+		}
+		desc := describeNew(p.Description)
+		if strings.HasPrefix(p.ID, "mount:") && had[strings.TrimSuffix(p.ID, ":rw")+":ro"] {
+			desc += ", was read-only"
+		}
+		out = append(out, Permission{ID: p.ID, Description: desc})
+	}
+	return out
+}
+
+// describeNew rephrases a permission description as a change.
+func describeNew(desc string) string {
+	for _, verb := range []string{"mounts ", "runs as ", "shares "} {
+		if strings.HasPrefix(desc, verb) {
+			return "now " + desc
+		}
+	}
+	if desc == "network access" {
+		return "now has " + desc
+	}
+	for _, noun := range []string{"device ", "kernel capability ", "docker option ", "network "} {
+		if strings.HasPrefix(desc, noun) {
+			return "new " + desc
+		}
+	}
+	return "now has " + desc
+}
@@ -0,0 +1,128 @@
+package permission
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/endophage/conman/manifest"
+)
+
+func TestEscalations(t *testing.T) {
+	base := func() *manifest.Invocation {
+		return &manifest.Invocation{
+			Image:   "conman/apps:atom",
+			Mounts:  []manifest.Mount{{Source: "/data", Target: "/data", ReadOnly: true}},
+			Devices: []string{"/dev/dri"},
+			CapAdd:  []string{"SYS_PTRACE"},
+			Network: "none",
+			User:    "1000",
+			X11:     true,
+		}
+	}
+	for _, tt := range []struct {
+		name   string
+		change func(inv *manifest.Invocation)
+		want   []string
+	}{
+		{name: "unchanged", change: func(inv *manifest.Invocation) {}},
+		{
+			name: "new mount",
+			change: func(inv *manifest.Invocation) {
+				inv.Mounts = append(inv.Mounts, manifest.Mount{Source: "/home/user", Target: "/home/atom"})
+			},
+			want: []string{"now mounts /home/user read-write"},
+		},
+		{name: "removed mount", change: func(inv *manifest.Invocation) { inv.Mounts = nil }},
+		{
+			name:   "read-only to read-write",
+			change: func(inv *manifest.Invocation) { inv.Mounts[0].ReadOnly = false },
+			want:   []string{"now mounts /data read-write, was read-only"},
+		},
+		{
+			name: "same path elsewhere in the container",
+			change: func(inv *manifest.Invocation) {
+				inv.Mounts[0].Target = "/mnt"
+			},
+		},
+		{
+			name:   "new device",
+			change: func(inv *manifest.Invocation) { inv.Devices = append(inv.Devices, "/dev/snd") },
+			want:   []string{"new device /dev/snd"},
+		},
+		{name: "removed device", change: func(inv *manifest.Invocation) { inv.Devices = nil }},
+		{
+			name:   "new capability",
+			change: func(inv *manifest.Invocation) { inv.CapAdd = append(inv.CapAdd, "SYS_ADMIN") },
+			want:   []string{"new kernel capability SYS_ADMIN"},
+		},
+		{name: "removed capability", change: func(inv *manifest.Invocation) { inv.CapAdd = nil }},
+		{
+			name:   "privileged",
+			change: func(inv *manifest.Invocation) { inv.Privileged = true },
+			want:   []string{"now has full access to the host (--privileged)"},
+		},
+		{
+			name:   "network",
+			change: func(inv *manifest.Invocation) { inv.Network = "" },
+			want:   []string{"now has network access"},
+		},
+		{
+			name:   "named network",
+			change: func(inv *manifest.Invocation) { inv.Network = "backend" },
+			want:   []string{"new network backend"},
+		},
+		{
+			name:   "host network",
+			change: func(inv *manifest.Invocation) { inv.Network = "host" },
+			want:   []string{"now shares the host's network stack"},
+		},
+		{
+			name:   "user",
+			change: func(inv *manifest.Invocation) { inv.User = "" },
+			want:   []string{"now runs as the image's default user, usually root"},
+		},
+		{
+			name:   "pulseaudio",
+			change: func(inv *manifest.Invocation) { inv.PulseAudio = true },
+			want:   []string{"now has access to your PulseAudio sound server, including microphones"},
+		},
+		{name: "no more X11", change: func(inv *manifest.Invocation) { inv.X11 = false }},
+		{
+			name:   "pass-through option",
+			change: func(inv *manifest.Invocation) { inv.Options = []string{"--pid=host"} },
+			want:   []string{"new docker option --pid=host"},
+		},
+		{
+			name: "several",
+			change: func(inv *manifest.Invocation) {
+				inv.Mounts[0].ReadOnly = false
+				inv.Devices = []string{"/dev/video0"}
+				inv.Network = "host"
+			},
+			want: []string{
+				"now mounts /data read-write, was read-only",
+				"new device /dev/video0",
+				"now shares the host's network stack",
+			},
+		},
+	} {
+		cur := base()
+		tt.change(cur)
+		var got []string
+		for _, p := range Escalations(FromInvocation(base()), FromInvocation(cur)) {
+			got = append(got, p.Description)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: escalations %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEscalationsFromNothing(t *testing.T) {
+	perms := FromInvocation(&manifest.Invocation{Network: "none", User: "1000"})
+	got := Escalations(nil, perms)
+	want := []Permission{{ID: "user:1000", Description: "now runs as user 1000"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("escalations from no permissions %v, want %v", got, want)
+	}
+}
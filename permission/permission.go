@@ -0,0 +1,111 @@
+// Package permission describes what an application's container can access
+// on the host, so users can review it before installing the application.
+package permission
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/endophage/conman/manifest"
+)
+
+// Permission is a single kind of host access granted to a container.
+type Permission struct {
+	// ID identifies the permission in allowlists, e.g. mount:/etc:rw or
+	// device:/dev/video0.
+	ID string
+	// Description is a human readable description of the permission.
+	Description string
+}
+
+func (p Permission) String() string {
+	return p.Description
+}
+
+// Review returns the permissions the application described by m is granted
+// when launched in the given host session.
+func Review(m *manifest.Manifest, h *manifest.Host) ([]Permission, error) {
+	inv, err := m.Invocation(h)
+	if err != nil {
+		return nil, fmt.Errorf("analyzing container invocation: %v", err)
+	}
+	return FromInvocation(inv), nil
+}
+
+// FromInvocation returns the permissions granted by a docker invocation.
+func FromInvocation(inv *manifest.Invocation) []Permission {
+	var perms []Permission
+	add := func(id, format string, args ...interface{}) {
+		perms = append(perms, Permission{ID: id, Description: fmt.Sprintf(format, args...)})
+	}
+
+	if inv.Privileged {
+		add("privileged", "full access to the host (--privileged)")
+	}
+	for _, c := range inv.CapAdd {
+		add("cap:"+c, "kernel capability %s", c)
+	}
+	for _, m := range inv.Mounts {
+		add(MountID(m), "mounts %s %s", m.Source, mountMode(m))
+	}
+	for _, d := range inv.Devices {
+		add("device:"+d, "device %s", d)
+	}
+	if inv.X11 {
+		add("x11", "access to your X11 display, including other windows and input")
+	}
+	if inv.PulseAudio {
+		add("pulseaudio", "access to your PulseAudio sound server, including microphones")
+	}
+	switch inv.Network {
+	case "":
+		add("network", "network access")
+	case "none":
+	case "host":
+		add("network:host", "shares the host's network stack")
+	default:
+		add("network:"+inv.Network, "network %s", inv.Network)
+	}
+	if inv.User == "" {
+		add("user:default", "runs as the image's default user, usually root")
+	} else {
+		add("user:"+inv.User, "runs as user %s", inv.User)
+	}
+	for _, o := range inv.Options {
+		add("option:"+o, "docker option %s", o)
+	}
+	return perms
+}
+
+// MountID returns the permission ID of a bind mount.
+func MountID(m manifest.Mount) string {
+	if m.ReadOnly {
+		return "mount:" + m.Source + ":ro"
+	}
+	return "mount:" + m.Source + ":rw"
+}
+
+func mountMode(m manifest.Mount) string {
+	if m.ReadOnly {
+		return "read-only"
+	}
+	return "read-write"
+}
+
+// IDs returns the IDs of perms.
+func IDs(perms []Permission) []string {
+	ids := make([]string, len(perms))
+	for i, p := range perms {
+		ids[i] = p.ID
+	}
+	return ids
+}
+
+// readWriteVariant returns the ID of the read-write mount covering a
+// read-only mount permission, or the empty string for other permissions.
+func readWriteVariant(id string) string {
+	if strings.HasPrefix(id, "mount:") && strings.HasSuffix(id, ":ro") {
+		return strings.TrimSuffix(id, ":ro") + ":rw"
+	}
+	return ""
+}
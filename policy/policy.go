@@ -0,0 +1,338 @@
+// Package policy evaluates application manifests against rules set by an
+// administrator, so that manifests granting too much access to the host are
+// refused whatever the user answers when asked for consent.
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/endophage/conman/manifest"
+)
+
+// DefaultFile is the system wide policy file. It is always enforced, any
+// configured policy only adds to it.
+const DefaultFile = "/etc/conman/policy.json"
+
+// Rule types.
+const (
+	// DenyMount denies bind mounting any of Paths, anything beneath them,
+	// or any directory containing them. With Mode "rw" only read-write
+	// mounts are denied.
+	DenyMount = "deny-mount"
+	// DenyPrivileged denies --privileged containers.
+	DenyPrivileged = "deny-privileged"
+	// RequireRemove requires containers to be run with --rm.
+	RequireRemove = "require-rm"
+	// AllowDevices denies devices not matching one of Paths, which are
+	// path.Match patterns.
+	AllowDevices = "allow-devices"
+	// AllowGUN denies catalogs whose GUN is not one of Prefixes or beneath
+	// one of them.
+	AllowGUN = "allow-gun"
+	// AllowCapabilities denies adding capabilities other than Capabilities.
+	AllowCapabilities = "allow-caps"
+	// DenyHostNamespaces denies sharing the host's network, PID, IPC, UTS
+	// or user namespace.
+	DenyHostNamespaces = "deny-host-namespaces"
+	// DenyOptions denies any of the docker run Options not otherwise
+	// analyzed, such as --security-opt, whatever their value.
+	DenyOptions = "deny-options"
+)
+
+// hostNamespaceOptions are the docker run options sharing a host namespace
+// when given the value "host".
+var hostNamespaceOptions = []string{"--pid", "--ipc", "--uts", "--userns"}
+
+// Rule is a single policy rule.
+type Rule struct {
+	// ID identifies the rule in violations.
+	ID string `json:"id"`
+	// Type is one of the rule types.
+	Type string `json:"type"`
+	// Paths are the paths or patterns the rule applies to.
+	Paths []string `json:"paths,omitempty"`
+	// Mode restricts deny-mount rules to read-write mounts when "rw".
+	Mode string `json:"mode,omitempty"`
+	// Prefixes are the GUN prefixes allowed by allow-gun rules. They match
+	// whole path components, so docker.io/acme does not allow
+	// docker.io/acme-evil.
+	Prefixes []string `json:"prefixes,omitempty"`
+	// Capabilities are the capabilities allowed by allow-caps rules, with
+	// or without the CAP_ prefix.
+	Capabilities []string `json:"capabilities,omitempty"`
+	// Options are the long docker run options denied by deny-options
+	// rules, such as --security-opt.
+	Options []string `json:"options,omitempty"`
+}
+
+// Policy is an ordered list of rules, all of which a manifest must satisfy.
+type Policy struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Violation is a broken policy rule.
+type Violation struct {
+	Rule    string
+	Message string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("[%s] %s", v.Rule, v.Message)
+}
+
+// ErrDenied is returned for applications that violate the policy.
+type ErrDenied struct {
+	App        string
+	Violations []Violation
+}
+
+func (err ErrDenied) Error() string {
+	msgs := make([]string, len(err.Violations))
+	for i, v := range err.Violations {
+		msgs[i] = v.String()
+	}
+	return fmt.Sprintf("%s is denied by policy: %s", err.App, strings.Join(msgs, "; "))
+}
+
+// Load reads and checks the policy file at path.
+func Load(path string) (*Policy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	p := &Policy{}
+	if err := json.NewDecoder(f).Decode(p); err != nil {
+		return nil, fmt.Errorf("parsing policy %s: %v", path, err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("policy %s: %v", path, err)
+	}
+	return p, nil
+}
+
+// Merge returns a policy with the rules of each of policies, so a manifest
+// must satisfy all of them. Adding a policy can therefore only deny more.
+// Nil policies are skipped, and nil is returned if all of them are nil.
+func Merge(policies ...*Policy) *Policy {
+	var merged *Policy
+	for _, p := range policies {
+		if p == nil {
+			continue
+		}
+		if merged == nil {
+			merged = &Policy{}
+		}
+		merged.Rules = append(merged.Rules, p.Rules...)
+	}
+	return merged
+}
+
+func (p *Policy) validate() error {
+	seen := make(map[string]bool)
+	for i, r := range p.Rules {
+		if r.ID == "" {
+			return fmt.Errorf("rules[%d]: missing id", i)
+		}
+		if seen[r.ID] {
+			return fmt.Errorf("rules[%d]: duplicate id %q", i, r.ID)
+		}
+		seen[r.ID] = true
+
+		switch r.Type {
+		case DenyMount:
+			if len(r.Paths) == 0 {
+				return fmt.Errorf("rule %s: %s needs paths", r.ID, r.Type)
+			}
+			for _, p := range r.Paths {
+				if !filepath.IsAbs(p) {
+					return fmt.Errorf("rule %s: %q is not an absolute path", r.ID, p)
+				}
+			}
+			if r.Mode != "" && r.Mode != "rw" {
+				return fmt.Errorf("rule %s: unknown mode %q", r.ID, r.Mode)
+			}
+		case AllowDevices:
+			for _, p := range r.Paths {
+				if _, err := path.Match(p, ""); err != nil {
+					return fmt.Errorf("rule %s: bad pattern %q", r.ID, p)
+				}
+			}
+		case AllowGUN:
+			if len(r.Prefixes) == 0 {
+				return fmt.Errorf("rule %s: %s needs prefixes", r.ID, r.Type)
+			}
+		case DenyOptions:
+			if len(r.Options) == 0 {
+				return fmt.Errorf("rule %s: %s needs options", r.ID, r.Type)
+			}
+			for _, o := range r.Options {
+				if !strings.HasPrefix(o, "--") || strings.Contains(o, "=") {
+					return fmt.Errorf("rule %s: %q is not a long option name", r.ID, o)
+				}
+			}
+		case DenyPrivileged, RequireRemove, AllowCapabilities, DenyHostNamespaces:
+		default:
+			return fmt.Errorf("rule %s: unknown type %q", r.ID, r.Type)
+		}
+	}
+	return nil
+}
+
+// Check evaluates the docker invocation of an application from the catalog
+// gun against the policy, and returns every violation. A nil Policy allows
+// everything.
+func (p *Policy) Check(gun string, inv *manifest.Invocation) []Violation {
+	if p == nil {
+		return nil
+	}
+	var violations []Violation
+	for _, r := range p.Rules {
+		addf := func(format string, args ...interface{}) {
+			violations = append(violations, Violation{Rule: r.ID, Message: fmt.Sprintf(format, args...)})
+		}
+		switch r.Type {
+		case DenyMount:
+			for _, m := range inv.Mounts {
+				if m.ReadOnly && r.Mode == "rw" {
+					continue
+				}
+				for _, denied := range r.Paths {
+					if overlaps(m.Source, denied) {
+						addf("mounting %s %s is denied", m.Source, mode(m))
+						break
+					}
+				}
+			}
+		case DenyPrivileged:
+			if inv.Privileged {
+				addf("privileged containers are denied")
+			}
+		case RequireRemove:
+			if !inv.Remove {
+				addf("containers must be run with --rm")
+			}
+		case AllowDevices:
+			for _, d := range inv.Devices {
+				if !matchAny(r.Paths, d) {
+					addf("device %s is not allowed", d)
+				}
+			}
+		case AllowGUN:
+			if !beneathAny(gun, r.Prefixes) {
+				addf("catalog %s is not allowed", gun)
+			}
+		case AllowCapabilities:
+			for _, c := range inv.CapAdd {
+				if !hasCapability(r.Capabilities, c) {
+					addf("capability %s is not allowed", c)
+				}
+			}
+		case DenyHostNamespaces:
+			if inv.Network == "host" {
+				addf("the host network namespace is denied")
+			}
+			for _, o := range hostNamespaceOptions {
+				if hasOption(inv.Options, o+"=host") {
+					addf("%s=host is denied", o)
+				}
+			}
+		case DenyOptions:
+			for _, o := range inv.Options {
+				if hasOption(r.Options, optionName(o)) {
+					addf("%s is denied", o)
+				}
+			}
+		}
+	}
+	return violations
+}
+
+// Evaluate checks an application's manifest, as launched in the given host
+// session, against the policy. It returns ErrDenied if any rule is broken.
+func (p *Policy) Evaluate(app, gun string, m *manifest.Manifest, h *manifest.Host) error {
+	if p == nil {
+		return nil
+	}
+	inv, err := m.Invocation(h)
+	if err != nil {
+		return fmt.Errorf("%s: analyzing container invocation: %v", app, err)
+	}
+	if violations := p.Check(gun, inv); len(violations) > 0 {
+		return ErrDenied{App: app, Violations: violations}
+	}
+	return nil
+}
+
+// overlaps reports whether mounting src exposes any of path: src is path,
+// is beneath it, or contains it.
+func overlaps(src, path string) bool {
+	src, path = filepath.Clean(src), filepath.Clean(path)
+	return within(src, path) || within(path, src)
+}
+
+func within(p, dir string) bool {
+	return p == dir || dir == "/" || strings.HasPrefix(p, dir+"/")
+}
+
+func mode(m manifest.Mount) string {
+	if m.ReadOnly {
+		return "read-only"
+	}
+	return "read-write"
+}
+
+func matchAny(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// beneathAny reports whether gun is one of prefixes or beneath one of them,
+// comparing whole path components.
+func beneathAny(gun string, prefixes []string) bool {
+	for _, p := range prefixes {
+		p = strings.TrimSuffix(p, "/")
+		if gun == p || strings.HasPrefix(gun, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// hasCapability reports whether capability c, as normalized in
+// manifest.Invocation, is one of caps.
+func hasCapability(caps []string, c string) bool {
+	for _, allowed := range caps {
+		if strings.TrimPrefix(strings.ToUpper(allowed), "CAP_") == c {
+			return true
+		}
+	}
+	return false
+}
+
+func hasOption(opts []string, o string) bool {
+	for _, opt := range opts {
+		if opt == o {
+			return true
+		}
+	}
+	return false
+}
+
+// optionName returns the name of an option given as --name=value.
+func optionName(o string) string {
+	if i := strings.Index(o, "="); i >= 0 {
+		return o[:i]
+	}
+	return o
+}
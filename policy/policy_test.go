@@ -0,0 +1,132 @@
+package policy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/endophage/conman/manifest"
+)
+
+var testPolicy = &Policy{Rules: []Rule{
+	{ID: "no-rw-system", Type: DenyMount, Paths: []string{"/etc", "/usr"}, Mode: "rw"},
+	{ID: "no-home", Type: DenyMount, Paths: []string{"/home/user/.ssh"}},
+	{ID: "no-privileged", Type: DenyPrivileged},
+	{ID: "require-rm", Type: RequireRemove},
+	{ID: "devices", Type: AllowDevices, Paths: []string{"/dev/snd", "/dev/video[0-9]"}},
+	{ID: "catalogs", Type: AllowGUN, Prefixes: []string{"docker.io/conman/", "docker.io/acme"}},
+	{ID: "caps", Type: AllowCapabilities, Capabilities: []string{"CAP_SYS_NICE"}},
+	{ID: "no-host-ns", Type: DenyHostNamespaces},
+	{ID: "no-security-opt", Type: DenyOptions, Options: []string{"--security-opt"}},
+}}
+
+func TestCheck(t *testing.T) {
+	const gun = "docker.io/conman/apps"
+	for _, tt := range []struct {
+		name  string
+		gun   string
+		cmd   string
+		rules []string
+	}{
+		{"allowed", gun, "docker run --rm -v /etc/localtime:/etc/localtime:ro --device /dev/video0 atom", nil},
+		{"rw system mount", gun, "docker run --rm -v /usr/share:/usr/share atom", []string{"no-rw-system"}},
+		{"rw mount containing a denied path", gun, "docker run --rm -v /:/host atom", []string{"no-rw-system", "no-home"}},
+		{"ro mount of a denied path", gun, "docker run --rm -v /home/user:/home:ro atom", []string{"no-home"}},
+		{"bind --mount", gun, "docker run --rm --mount type=bind,src=/etc,dst=/etc atom", []string{"no-rw-system"}},
+		{"privileged", gun, "docker run --rm --privileged atom", []string{"no-privileged"}},
+		{"no --rm", gun, "docker run atom", []string{"require-rm"}},
+		{"device", gun, "docker run --rm --device /dev/sda atom", []string{"devices"}},
+		{"catalog", "docker.io/other/apps", "docker run --rm atom", []string{"catalogs"}},
+		{"catalog named as a prefix", "docker.io/acme", "docker run --rm atom", nil},
+		{"catalog beneath a prefix", "docker.io/acme/apps", "docker run --rm atom", nil},
+		{"catalog sharing a prefix", "docker.io/acme-evil/apps", "docker run --rm atom", []string{"catalogs"}},
+		{"catalog sharing a prefix with a slash", "docker.io/conman-evil/apps", "docker run --rm atom", []string{"catalogs"}},
+		{"allowed capability", gun, "docker run --rm --cap-add sys_nice atom", nil},
+		{"capability", gun, "docker run --rm --cap-add SYS_NICE --cap-add CAP_SYS_ADMIN atom", []string{"caps"}},
+		{"host network", gun, "docker run --rm --network=host atom", []string{"no-host-ns"}},
+		{"host pid and ipc", gun, "docker run --rm --pid=host --ipc host atom", []string{"no-host-ns", "no-host-ns"}},
+		{"container pid", gun, "docker run --rm --pid=container:other atom", nil},
+		{"security option", gun, "docker run --rm --security-opt seccomp=unconfined atom", []string{"no-security-opt"}},
+	} {
+		inv, err := manifest.ParseDockerRun(strings.Fields(tt.cmd), nil)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var rules []string
+		for _, v := range testPolicy.Check(tt.gun, inv) {
+			rules = append(rules, v.Rule)
+		}
+		if !reflect.DeepEqual(rules, tt.rules) {
+			t.Errorf("%s: violated %v, want %v", tt.name, rules, tt.rules)
+		}
+	}
+}
+
+func TestNilPolicy(t *testing.T) {
+	var p *Policy
+	inv := &manifest.Invocation{Image: "atom", Privileged: true}
+	if v := p.Check("docker.io/other/apps", inv); v != nil {
+		t.Errorf("nil policy denied %v", v)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	system := &Policy{Rules: []Rule{{ID: "no-privileged", Type: DenyPrivileged}}}
+	user := &Policy{Rules: []Rule{{ID: "require-rm", Type: RequireRemove}}}
+	if Merge(nil, nil) != nil {
+		t.Error("merging nil policies must allow everything")
+	}
+	if got := Merge(system, nil); !reflect.DeepEqual(got, system) {
+		t.Errorf("Merge(system, nil) = %+v", got)
+	}
+
+	// a user policy adds to the system policy, it cannot lift its rules
+	inv := &manifest.Invocation{Image: "atom", Privileged: true}
+	var rules []string
+	for _, v := range Merge(system, user).Check("docker.io/conman/apps", inv) {
+		rules = append(rules, v.Rule)
+	}
+	if want := []string{"no-privileged", "require-rm"}; !reflect.DeepEqual(rules, want) {
+		t.Errorf("violated %v, want %v", rules, want)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, tt := range []struct {
+		policy string
+		err    string
+	}{
+		{`{"rules":[{"id":"a","type":"deny-privileged"}]}`, ""},
+		{`{"rules":[{"type":"deny-privileged"}]}`, "missing id"},
+		{`{"rules":[{"id":"a","type":"deny-privileged"},{"id":"a","type":"require-rm"}]}`, "duplicate id"},
+		{`{"rules":[{"id":"a","type":"deny-mount"}]}`, "needs paths"},
+		{`{"rules":[{"id":"a","type":"deny-mount","paths":["etc"]}]}`, "not an absolute path"},
+		{`{"rules":[{"id":"a","type":"deny-mount","paths":["/etc"],"mode":"ro"}]}`, "unknown mode"},
+		{`{"rules":[{"id":"a","type":"allow-devices","paths":["/dev/["]}]}`, "bad pattern"},
+		{`{"rules":[{"id":"a","type":"allow-gun"}]}`, "needs prefixes"},
+		{`{"rules":[{"id":"a","type":"allow-caps"}]}`, ""},
+		{`{"rules":[{"id":"a","type":"deny-host-namespaces"}]}`, ""},
+		{`{"rules":[{"id":"a","type":"deny-options"}]}`, "needs options"},
+		{`{"rules":[{"id":"a","type":"deny-options","options":["--pid=host"]}]}`, "not a long option name"},
+		{`{"rules":[{"id":"a","type":"deny-options","options":["pid"]}]}`, "not a long option name"},
+		{`{"rules":[{"id":"a","type":"allow-all"}]}`, "unknown type"},
+	} {
+		path := filepath.Join(dir, "policy.json")
+		if err := ioutil.WriteFile(path, []byte(tt.policy), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := Load(path)
+		if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%s: got error %v, want %q", tt.policy, err, tt.err)
+		}
+	}
+}
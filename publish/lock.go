@@ -0,0 +1,105 @@
+package publish
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/docker/notary"
+	"github.com/docker/notary/tuf/data"
+	"github.com/endophage/conman/manifest"
+	"github.com/riyazdf/notary/client"
+)
+
+// LockFileName is the name of the lockfile read from a manifest directory
+// when no other is given.
+const LockFileName = "apps.lock"
+
+// Lock pins the image published for each application, keyed by app name.
+type Lock map[string]LockEntry
+
+// LockEntry is the image pinned for a single application. An entry with
+// no digest is not resolved yet, and is pinned when publishing resolves
+// digests from the registry.
+type LockEntry struct {
+	// Digest is the hex encoded sha256 digest of the image manifest.
+	Digest string `json:"digest"`
+	// Size is the size in bytes of the image manifest.
+	Size int64 `json:"size"`
+}
+
+// LoadLock reads the lockfile at path.
+func LoadLock(path string) (Lock, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	lock := Lock{}
+	if err := json.NewDecoder(f).Decode(&lock); err != nil {
+		return nil, fmt.Errorf("parsing lockfile %s: %v", path, err)
+	}
+	for name, entry := range lock {
+		if err := manifest.CheckAppName(name); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if !entry.Resolved() && entry.Size == 0 {
+			continue
+		}
+		if _, err := entry.hashes(); err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", path, name, err)
+		}
+	}
+	return lock, nil
+}
+
+// Names returns the locked app names in sorted order.
+func (l Lock) Names() []string {
+	names := make([]string, 0, len(l))
+	for name := range l {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Resolved reports whether the entry pins an image.
+func (e LockEntry) Resolved() bool {
+	return e.Digest != ""
+}
+
+// Target returns the TUF target for the named app.
+func (e LockEntry) Target(name string) (*client.Target, error) {
+	hashes, err := e.hashes()
+	if err != nil {
+		return nil, err
+	}
+	return &client.Target{Name: name, Hashes: hashes, Length: e.Size}, nil
+}
+
+func (e LockEntry) hashes() (data.Hashes, error) {
+	if len(e.Digest) != notary.Sha256HexSize {
+		return nil, fmt.Errorf("digest %q is not a hex sha256", e.Digest)
+	}
+	d, err := hex.DecodeString(e.Digest)
+	if err != nil {
+		return nil, fmt.Errorf("digest %q is not a hex sha256", e.Digest)
+	}
+	if e.Size <= 0 {
+		return nil, fmt.Errorf("size must be positive")
+	}
+	return data.Hashes{"sha256": d}, nil
+}
+
+// Save writes the lockfile to path.
+func (l Lock) Save(path string) error {
+	b, err := json.MarshalIndent(l, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0644)
+}
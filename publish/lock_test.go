@@ -0,0 +1,53 @@
+package publish
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	digest := strings.Repeat("ab", 32)
+
+	for _, tt := range []struct {
+		lock string
+		err  string
+	}{
+		{`{"atom":{"digest":"` + digest + `","size":10}}`, ""},
+		{`{"atom":{"digest":"","size":0}}`, ""},
+		{`{"atom":{"digest":"","size":10}}`, "not a hex sha256"},
+		{`{"atom":{"digest":"abc","size":10}}`, "not a hex sha256"},
+		{`{"atom":{"digest":"` + digest + `","size":0}}`, "size must be positive"},
+		{`{"../atom":{"digest":"","size":0}}`, "invalid app name"},
+	} {
+		path := filepath.Join(dir, LockFileName)
+		if err := ioutil.WriteFile(path, []byte(tt.lock), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := LoadLock(path)
+		if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%s: got error %v, want %q", tt.lock, err, tt.err)
+		}
+	}
+}
+
+func TestLoadDirUnresolved(t *testing.T) {
+	lock, err := LoadLock("../setup/" + LockFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	releases, err := LoadDir("../setup", lock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := Unresolved(releases); len(got) != len(lock) {
+		t.Errorf("unresolved releases %v, want all of %v", got, lock.Names())
+	}
+}
@@ -0,0 +1,194 @@
+// Package publish stages manifests and their pinned images as targets of
+// the conman catalog.
+package publish
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	cjson "github.com/docker/go/canonical/json"
+	"github.com/docker/notary/tuf/data"
+	"github.com/endophage/conman/manifest"
+	"github.com/riyazdf/notary/client"
+)
+
+// Release is an application ready to be published.
+type Release struct {
+	Target   *client.Target
+	Manifest *manifest.Manifest
+	Custom   cjson.RawMessage
+	// Role is the role to sign the target with, the base targets role if
+	// empty.
+	Role string
+}
+
+func (r *Release) role() string {
+	if r.Role == "" {
+		return data.CanonicalTargetsRole
+	}
+	return r.Role
+}
+
+// LoadDir reads and validates the manifest <name>.json in dir for every app
+// in lock. Manifests in dir that are not locked are skipped with a warning.
+// Apps whose lock entry is not resolved get a target without hashes, to be
+// filled in by Resolve.
+func LoadDir(dir string, lock Lock) ([]*Release, error) {
+	var releases []*Release
+	for _, name := range lock.Names() {
+		path := filepath.Join(dir, name+".json")
+		m, err := manifest.Load(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := m.ValidateApp(name); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if m.Run == nil {
+			logrus.Warnf("%s: the desktop entry's raw Exec launches the image by tag, convert it to a run spec so installs pin the image by digest", path)
+		}
+		tgt := &client.Target{Name: name}
+		if lock[name].Resolved() {
+			if tgt, err = lock[name].Target(name); err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+		}
+		custom, err := m.Custom()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		releases = append(releases, &Release{Target: tgt, Manifest: m, Custom: custom})
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, fi := range files {
+		name := strings.TrimSuffix(fi.Name(), ".json")
+		if fi.IsDir() || name == fi.Name() {
+			continue
+		}
+		if _, ok := lock[name]; !ok {
+			logrus.Warnf("skipping %s: not in lockfile", fi.Name())
+		}
+	}
+	return releases, nil
+}
+
+// ChangeKind classifies how a release differs from the published catalog.
+type ChangeKind int
+
+// The kinds of change a release can make.
+const (
+	Unchanged ChangeKind = iota
+	Added
+	Updated
+	// Unmanaged marks a published target that has no release. It is left
+	// in the catalog.
+	Unmanaged
+)
+
+// Change describes the difference between a release and the currently
+// published target of the same name.
+type Change struct {
+	Kind    ChangeKind
+	Name    string
+	Release *Release
+	Current *client.TargetWithRole
+	// Fields lists what changed for Updated releases.
+	Fields []string
+}
+
+func (c Change) String() string {
+	switch c.Kind {
+	case Added:
+		return fmt.Sprintf("+ %s (sha256:%x, %d bytes)", c.Name, c.Release.Target.Hashes["sha256"], c.Release.Target.Length)
+	case Updated:
+		return fmt.Sprintf("~ %s (%s)", c.Name, strings.Join(c.Fields, ", "))
+	case Unmanaged:
+		return fmt.Sprintf("? %s (published, not in lockfile)", c.Name)
+	default:
+		return fmt.Sprintf("  %s", c.Name)
+	}
+}
+
+// Diff compares releases against the currently published targets.
+func Diff(current []*client.TargetWithRole, releases []*Release) []Change {
+	published := make(map[string]*client.TargetWithRole, len(current))
+	for _, t := range current {
+		published[t.Name] = t
+	}
+
+	var changes []Change
+	for _, r := range releases {
+		c := Change{Name: r.Target.Name, Release: r, Current: published[r.Target.Name]}
+		delete(published, r.Target.Name)
+		if c.Current == nil {
+			c.Kind = Added
+		} else if c.Fields = changedFields(c.Current, r); len(c.Fields) > 0 {
+			c.Kind = Updated
+		}
+		changes = append(changes, c)
+	}
+	for name, t := range published {
+		changes = append(changes, Change{Kind: Unmanaged, Name: name, Current: t})
+	}
+	sort.Sort(byName(changes))
+	return changes
+}
+
+func changedFields(cur *client.TargetWithRole, r *Release) []string {
+	var fields []string
+	if prev, next := cur.Hashes["sha256"], r.Target.Hashes["sha256"]; !bytes.Equal(prev, next) {
+		fields = append(fields, fmt.Sprintf("digest %x -> %x", prev, next))
+	}
+	if cur.Length != r.Target.Length {
+		fields = append(fields, fmt.Sprintf("size %d -> %d", cur.Length, r.Target.Length))
+	}
+	if cur.Role != r.role() {
+		fields = append(fields, fmt.Sprintf("role %s -> %s", cur.Role, r.role()))
+	}
+	// compare re-encoded manifests so formatting differences are ignored
+	if m, err := manifest.FromCustom(cur.Custom); err != nil {
+		fields = append(fields, "manifest (published one is invalid)")
+	} else if custom, err := m.Custom(); err != nil || !bytes.Equal(custom, r.Custom) {
+		fields = append(fields, "manifest")
+	}
+	return fields
+}
+
+type byName []Change
+
+func (c byName) Len() int           { return len(c) }
+func (c byName) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c byName) Less(i, j int) bool { return c[i].Name < c[j].Name }
+
+// Stage adds a changelist entry for every added or updated release, signed
+// by the release's role. Targets moving to another role are removed from
+// their current one, as it would otherwise shadow the new target. The
+// changes are pushed by a subsequent NotaryRepository.Publish.
+func Stage(repo *client.NotaryRepository, changes []Change) (int, error) {
+	staged := 0
+	for _, c := range changes {
+		if c.Kind != Added && c.Kind != Updated {
+			continue
+		}
+		role := c.Release.role()
+		if c.Current != nil && c.Current.Role != role {
+			if err := repo.RemoveTarget(c.Name, c.Current.Role); err != nil {
+				return staged, fmt.Errorf("staging removal of %s from %s: %v", c.Name, c.Current.Role, err)
+			}
+		}
+		if err := repo.AddTarget(c.Release.Target, c.Release.Custom, role); err != nil {
+			return staged, fmt.Errorf("staging %s: %v", c.Name, err)
+		}
+		staged++
+	}
+	return staged, nil
+}
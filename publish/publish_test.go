@@ -0,0 +1,57 @@
+package publish
+
+import (
+	"testing"
+
+	"github.com/docker/notary/tuf/data"
+	"github.com/riyazdf/notary/client"
+)
+
+func TestDiff(t *testing.T) {
+	lock, err := LoadLock("../setup/" + LockFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	releases, err := LoadDir("../setup", lock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[string]*Release)
+	for _, r := range releases {
+		r.Target.Hashes = data.Hashes{"sha256": []byte{1}}
+		r.Target.Length = 10
+		byName[r.Target.Name] = r
+	}
+	published := func(name, role string, length int64) *client.TargetWithRole {
+		r := byName[name]
+		return &client.TargetWithRole{
+			Target: client.Target{Name: name, Hashes: r.Target.Hashes, Length: length},
+			Role:   role,
+			Custom: r.Custom,
+		}
+	}
+	current := []*client.TargetWithRole{
+		published("atom", "targets", 10),
+		published("cheese", "targets", 20),
+		published("slack", "targets/spotify-team", 10),
+		{Target: client.Target{Name: "gimp"}, Role: "targets"},
+	}
+
+	want := map[string]ChangeKind{
+		"atom":    Unchanged,
+		"cheese":  Updated,
+		"slack":   Updated,
+		"skype":   Added,
+		"spotify": Added,
+		"gimp":    Unmanaged,
+	}
+	changes := Diff(current, releases)
+	if len(changes) != len(want) {
+		t.Fatalf("got %d changes, want %d: %v", len(changes), len(want), changes)
+	}
+	for _, c := range changes {
+		if kind, ok := want[c.Name]; !ok || c.Kind != kind {
+			t.Errorf("%s: got %v, want %v", c, c.Kind, kind)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package publish
+
+import (
+	"fmt"
+
+	"github.com/endophage/conman/catalog"
+	"github.com/endophage/conman/registry"
+)
+
+// Image returns the image reference published for the release.
+func (r *Release) Image() string {
+	return catalog.ImageFor(r.Target.Name, r.Manifest)
+}
+
+// Unresolved returns the names of the releases whose image is not pinned
+// in the lockfile.
+func Unresolved(releases []*Release) []string {
+	var names []string
+	for _, r := range releases {
+		if len(r.Target.Hashes) == 0 {
+			names = append(names, r.Target.Name)
+		}
+	}
+	return names
+}
+
+// Resolve pins every release to the image manifest its tag currently points
+// to in the registry, and records the result in lock.
+func Resolve(releases []*Release, lock Lock, reg *registry.Client) error {
+	for _, r := range releases {
+		desc, err := reg.Resolve(r.Image())
+		if err != nil {
+			return fmt.Errorf("%s: %v", r.Target.Name, err)
+		}
+		entry := LockEntry{Digest: desc.Digest, Size: desc.Size}
+		tgt, err := entry.Target(r.Target.Name)
+		if err != nil {
+			return fmt.Errorf("%s: %v", r.Target.Name, err)
+		}
+		r.Target = tgt
+		lock[r.Target.Name] = entry
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package registry
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// DefaultRegistry is the registry used for references that name none.
+	DefaultRegistry = "registry-1.docker.io"
+	defaultTag      = "latest"
+)
+
+// Reference is a parsed image reference of the form
+// [registry/]repository[:tag].
+type Reference struct {
+	// Registry is the registry host, or empty for the default registry.
+	Registry   string
+	Repository string
+	Tag        string
+}
+
+// ParseReference parses an image reference such as conman/apps:atom.
+// Single component repositories on the default registry get the library/
+// prefix, as they do in the docker CLI.
+func ParseReference(ref string) (Reference, error) {
+	var r Reference
+	if ref == "" || strings.Contains(ref, "@") {
+		return r, fmt.Errorf("invalid image reference %q: must be name[:tag]", ref)
+	}
+
+	if i := strings.Index(ref, "/"); i > 0 {
+		host := ref[:i]
+		if strings.ContainsAny(host, ".:") || host == "localhost" {
+			r.Registry = host
+			ref = ref[i+1:]
+		}
+	}
+	if i := strings.LastIndex(ref, ":"); i >= 0 && !strings.Contains(ref[i:], "/") {
+		r.Tag = ref[i+1:]
+		ref = ref[:i]
+	}
+	if r.Tag == "" {
+		r.Tag = defaultTag
+	}
+	if ref == "" {
+		return r, fmt.Errorf("invalid image reference: missing repository")
+	}
+	if r.Registry == "" && !strings.Contains(ref, "/") {
+		ref = "library/" + ref
+	}
+	r.Repository = ref
+	return r, nil
+}
+
+func (r Reference) String() string {
+	s := r.Repository + ":" + r.Tag
+	if r.Registry != "" {
+		s = r.Registry + "/" + s
+	}
+	return s
+}
+
+// WithDigest returns the reference to the same repository pinned to the
+// given hex encoded sha256 manifest digest.
+func (r Reference) WithDigest(digest string) string {
+	s := r.Repository + "@sha256:" + digest
+	if r.Registry != "" {
+		s = r.Registry + "/" + s
+	}
+	return s
+}
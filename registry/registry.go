@@ -0,0 +1,183 @@
+// Package registry resolves image tags to manifest digests using the Docker
+// Registry HTTP API v2.
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/notary"
+)
+
+// manifestTypes are the manifest media types accepted from the registry,
+// in order of preference.
+var manifestTypes = []string{
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v1+prettyjws",
+}
+
+// maxManifestSize is the largest manifest accepted from a registry.
+var maxManifestSize = notary.MaxDownloadSize
+
+// Descriptor identifies an image manifest by content.
+type Descriptor struct {
+	// Digest is the hex encoded sha256 digest of the manifest.
+	Digest string
+	// Size is the manifest's length in bytes.
+	Size int64
+}
+
+// Client talks to image registries.
+type Client struct {
+	// Registry, when set, replaces the default registry for references that
+	// do not name one, e.g. to point at a local registry.
+	Registry string
+	// Insecure uses plain HTTP instead of HTTPS.
+	Insecure bool
+	Client   *http.Client
+}
+
+// NewClient returns a Client for the default registry.
+func NewClient() *Client {
+	return &Client{Client: http.DefaultClient}
+}
+
+// Resolve fetches the manifest ref's tag currently points to, and returns
+// its digest and size.
+func (c *Client) Resolve(ref string) (*Descriptor, error) {
+	r, err := ParseReference(ref)
+	if err != nil {
+		return nil, err
+	}
+	host := r.Registry
+	if host == "" {
+		host = c.Registry
+	}
+	if host == "" {
+		host = DefaultRegistry
+	}
+	scheme := "https"
+	if c.Insecure {
+		scheme = "http"
+	}
+	u := fmt.Sprintf("%s://%s/v2/%s/manifests/%s", scheme, host, r.Repository, r.Tag)
+
+	resp, err := c.get(u, "repository:"+r.Repository+":pull")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("resolving %s: unexpected status %s", ref, resp.Status)
+	}
+
+	h := sha256.New()
+	size, err := io.Copy(h, io.LimitReader(resp.Body, maxManifestSize+1))
+	if err != nil {
+		return nil, err
+	}
+	// a truncated manifest would pin a digest no registry serves
+	if size > maxManifestSize {
+		return nil, fmt.Errorf("resolving %s: manifest is larger than %d bytes", ref, maxManifestSize)
+	}
+	d := &Descriptor{Digest: hex.EncodeToString(h.Sum(nil)), Size: size}
+
+	// the registry's claimed digest must match the content we received
+	if claimed := resp.Header.Get("Docker-Content-Digest"); claimed != "" && claimed != "sha256:"+d.Digest {
+		return nil, fmt.Errorf("resolving %s: registry reported digest %s but content has sha256:%s", ref, claimed, d.Digest)
+	}
+	logrus.Debugf("resolved %s to sha256:%s (%d bytes)", ref, d.Digest, d.Size)
+	return d, nil
+}
+
+// get performs a manifest GET, answering a bearer token challenge with an
+// anonymous token for scope if the registry requires one.
+func (c *Client) get(u, scope string) (*http.Response, error) {
+	resp, err := c.do(u, "")
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+
+	token, err := c.token(challenge, scope)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(u, token)
+}
+
+func (c *Client) do(u, token string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join(manifestTypes, ", "))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return c.Client.Do(req)
+}
+
+// token fetches an anonymous bearer token as described by a
+// WWW-Authenticate challenge.
+func (c *Client) token(challenge, scope string) (string, error) {
+	if !strings.HasPrefix(challenge, "Bearer ") {
+		return "", fmt.Errorf("unsupported registry authentication challenge %q", challenge)
+	}
+	params := parseChallenge(strings.TrimPrefix(challenge, "Bearer "))
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", fmt.Errorf("invalid token realm in challenge %q", challenge)
+	}
+	q := realm.Query()
+	if params["service"] != "" {
+		q.Set("service", params["service"])
+	}
+	q.Set("scope", scope)
+	realm.RawQuery = q.Encode()
+
+	resp, err := c.Client.Get(realm.String())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("fetching registry token: %s: %s", resp.Status, b)
+	}
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("fetching registry token: %v", err)
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	return body.AccessToken, nil
+}
+
+// parseChallenge parses the comma separated key="value" parameters of an
+// authentication challenge.
+func parseChallenge(s string) map[string]string {
+	params := make(map[string]string)
+	for _, part := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		params[strings.ToLower(kv[0])] = strings.Trim(kv[1], `"`)
+	}
+	return params
+}
@@ -0,0 +1,118 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const testManifest = `{"schemaVersion":2,"config":{"digest":"sha256:00"}}`
+
+func testDigest(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// testRegistry serves testManifest for conman/apps:atom, behind a bearer
+// token challenge if auth is set. Its manifest handler is replaced by
+// serve, when given.
+func testRegistry(t *testing.T, auth bool, serve func(w http.ResponseWriter)) (*httptest.Server, *Client) {
+	var srv *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("scope"); got != "repository:conman/apps:pull" {
+			t.Errorf("token scope = %q", got)
+		}
+		if got := r.URL.Query().Get("service"); got != "test-registry" {
+			t.Errorf("token service = %q", got)
+		}
+		fmt.Fprint(w, `{"token":"secret"}`)
+	})
+	mux.HandleFunc("/v2/conman/apps/manifests/atom", func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept"), manifestTypes[0]) {
+			t.Errorf("Accept = %q", r.Header.Get("Accept"))
+		}
+		if auth && r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test-registry"`, srv.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if serve != nil {
+			serve(w)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", "sha256:"+testDigest(testManifest))
+		fmt.Fprint(w, testManifest)
+	})
+	srv = httptest.NewServer(mux)
+	u, _ := url.Parse(srv.URL)
+	return srv, &Client{Registry: u.Host, Insecure: true, Client: http.DefaultClient}
+}
+
+func TestResolve(t *testing.T) {
+	for _, auth := range []bool{false, true} {
+		srv, c := testRegistry(t, auth, nil)
+		d, err := c.Resolve("conman/apps:atom")
+		srv.Close()
+		if err != nil {
+			t.Errorf("auth %v: %v", auth, err)
+			continue
+		}
+		if d.Digest != testDigest(testManifest) || d.Size != int64(len(testManifest)) {
+			t.Errorf("auth %v: got %+v", auth, d)
+		}
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	defer func(max int64) { maxManifestSize = max }(maxManifestSize)
+	maxManifestSize = int64(len(testManifest))
+
+	for _, tt := range []struct {
+		name  string
+		serve func(w http.ResponseWriter)
+		want  string
+	}{
+		{"digest mismatch", func(w http.ResponseWriter) {
+			w.Header().Set("Docker-Content-Digest", "sha256:"+testDigest("other"))
+			fmt.Fprint(w, testManifest)
+		}, "registry reported digest"},
+		{"too large", func(w http.ResponseWriter) {
+			fmt.Fprint(w, testManifest+" ")
+		}, "larger than"},
+		{"not found", func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusNotFound)
+		}, "404"},
+	} {
+		srv, c := testRegistry(t, true, tt.serve)
+		_, err := c.Resolve("conman/apps:atom")
+		srv.Close()
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestParseReference(t *testing.T) {
+	for _, tt := range []struct {
+		ref  string
+		want Reference
+	}{
+		{"atom", Reference{Repository: "library/atom", Tag: "latest"}},
+		{"conman/apps:atom", Reference{Repository: "conman/apps", Tag: "atom"}},
+		{"localhost:5000/apps:atom", Reference{Registry: "localhost:5000", Repository: "apps", Tag: "atom"}},
+	} {
+		got, err := ParseReference(tt.ref)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseReference(%q) = %+v, %v, want %+v", tt.ref, got, err, tt.want)
+		}
+	}
+	if _, err := ParseReference("apps@sha256:00"); err == nil {
+		t.Error("digest references must be rejected")
+	}
+}
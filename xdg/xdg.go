@@ -0,0 +1,54 @@
+// Package xdg resolves the XDG base directories conman installs into.
+package xdg
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+// DataHome returns $XDG_DATA_HOME, defaulting to ~/.local/share.
+func DataHome() (string, error) {
+	return fromEnv("XDG_DATA_HOME", ".local", "share")
+}
+
+// ConfigHome returns $XDG_CONFIG_HOME, defaulting to ~/.config.
+func ConfigHome() (string, error) {
+	return fromEnv("XDG_CONFIG_HOME", ".config")
+}
+
+// CacheHome returns $XDG_CACHE_HOME, defaulting to ~/.cache.
+func CacheHome() (string, error) {
+	return fromEnv("XDG_CACHE_HOME", ".cache")
+}
+
+// DataDirs returns the system data directories in $XDG_DATA_DIRS, defaulting
+// to /usr/local/share and /usr/share.
+func DataDirs() []string {
+	var dirs []string
+	for _, dir := range strings.Split(os.Getenv("XDG_DATA_DIRS"), ":") {
+		if filepath.IsAbs(dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	if len(dirs) == 0 {
+		dirs = []string{"/usr/local/share", "/usr/share"}
+	}
+	return dirs
+}
+
+// fromEnv returns the absolute path held in the named environment variable,
+// or the given path relative to the user's home directory. Relative values
+// are ignored as required by the XDG base directory specification.
+func fromEnv(name string, def ...string) (string, error) {
+	if dir := os.Getenv(name); dir != "" && filepath.IsAbs(dir) {
+		return dir, nil
+	}
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(append([]string{home}, def...)...), nil
+}